@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/lint"
+)
+
+// runCommand runs the command in args on the adapter behind c and writes the
+// results to w.
+func runCommand(c *controller.Controller, args []string, w io.Writer) error {
+	firmwareInfo, err := c.FirmwareInfo()
+	if err != nil {
+		return fmt.Errorf("failed to get firmware version: %w", err)
+	}
+	fmt.Fprintln(w, firmwareInfo)
+	fmt.Fprintln(w)
+
+	if len(args) > 0 && args[0] == "lint" {
+		return runLint(args[1:], c.Download, w)
+	}
+
+	if len(args) > 0 && args[0] == "profile" {
+		return runProfile(c, firmwareInfo, args[1:], w)
+	}
+
+	if len(args) > 0 && args[0] == "u" {
+		uploadFlags := flag.NewFlagSet("u", flag.ExitOnError)
+
+		mapPosition := uploadFlags.Int("mapPos", -1, "Map positon")
+		mapData := uploadFlags.String("map", "", "Map, the map in the slot if only buttons are edited")
+		set := uploadFlags.String("set", "", "Buttons to map, e.g. B=Fire1+AutoFire,Up=JoyUp")
+		remove := uploadFlags.String("remove", "", "Functions to remove from buttons, e.g. B=AutoFire")
+		clear := uploadFlags.String("clear", "", "Buttons to unmap, e.g. L+R")
+		verify := uploadFlags.Bool("verify", true, "Read the map back and compare it after uploading")
+		retries := uploadFlags.Int("retries", controller.DefaultUploadRetries, "Number of additional uploads when verification fails")
+		force := uploadFlags.Bool("force", false, "Upload even if lint finds errors in the map")
+
+		if err := uploadFlags.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+
+		if *mapPosition == -1 {
+			return errors.New("mapPos is required")
+		}
+
+		if *mapPosition < 0 || *mapPosition >= firmwareInfo.MapSlots {
+			return fmt.Errorf("mapPos must be between 0 and %d", firmwareInfo.MapSlots-1)
+		}
+
+		if err := firmwareInfo.Require(controller.FeatureUpload); err != nil {
+			return fmt.Errorf("cannot upload: %w", err)
+		}
+
+		var gamepadMap controller.GamepadMap
+		if *mapData == "" && (*set != "" || *remove != "" || *clear != "") {
+			if err := firmwareInfo.Require(controller.FeatureDownload); err != nil {
+				return fmt.Errorf("cannot download: %w", err)
+			}
+
+			maps, err := c.Download()
+			if err != nil {
+				return fmt.Errorf("failed to download: %w", err)
+			}
+			gamepadMap = maps[*mapPosition]
+		} else if gamepadMap, err = controller.ParseGamepadMap(*mapData); err != nil {
+			return fmt.Errorf("invalid map: %w", err)
+		}
+
+		if err := editMap(&gamepadMap, *set, *remove, *clear); err != nil {
+			return fmt.Errorf("invalid edit: %w", err)
+		}
+
+		if err := checkLint(w, lint.Map(gamepadMap), *force); err != nil {
+			return err
+		}
+
+		if *verify {
+			err = c.UploadVerifiedContext(context.Background(), uint8(*mapPosition), gamepadMap, *retries)
+		} else {
+			err = c.Upload(uint8(*mapPosition), gamepadMap)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to upload: %w", err)
+		}
+	}
+
+	if len(args) > 0 && args[0] == "apply" {
+		applyFlags := flag.NewFlagSet("apply", flag.ExitOnError)
+
+		mapsData := applyFlags.String("maps", "", "All maps, as comma separated or concatenated hex like in the cheat sheet URL")
+		force := applyFlags.Bool("force", false, "Apply even if lint finds errors in the maps")
+
+		if err := applyFlags.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+
+		if err := firmwareInfo.Require(controller.FeatureUpload); err != nil {
+			return fmt.Errorf("cannot upload: %w", err)
+		}
+
+		gamepadMaps, err := controller.ParseGamepadMaps(*mapsData)
+		if err != nil {
+			return fmt.Errorf("invalid maps: %w", err)
+		}
+
+		if err := checkLint(w, lint.Maps(gamepadMaps), *force); err != nil {
+			return err
+		}
+
+		changed, err := c.ApplyAll(gamepadMaps)
+		if err != nil {
+			return fmt.Errorf("failed to apply maps: %w", err)
+		}
+		fmt.Fprintf(w, "updated maps %v\n", changed)
+		fmt.Fprintln(w)
+	}
+
+	if err := firmwareInfo.Require(controller.FeatureDownload); err != nil {
+		return fmt.Errorf("cannot download: %w", err)
+	}
+
+	maps, err := c.Download()
+	if err != nil {
+		return fmt.Errorf("failed to download: %w", err)
+	}
+
+	// show names the functions of the buttons instead of printing hex
+	show := len(args) > 0 && args[0] == "show"
+
+	for i, m := range maps {
+		if show {
+			fmt.Fprintf(w, "%d: %s (%s)\n", i, m.Describe(), m.State())
+		} else {
+			fmt.Fprintf(w, "%d: %s\n", i, m.Hex())
+		}
+	}
+
+	return nil
+}
+
+// checkLint prints findings and fails on errors unless force is set.
+func checkLint(w io.Writer, findings []lint.Finding, force bool) error {
+	for _, f := range findings {
+		fmt.Fprintln(w, f)
+	}
+
+	if lint.Max(findings) >= lint.Error && !force {
+		return errors.New("lint found errors, use -force to upload anyway")
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/diff"
+	"snes2c64gui/pkg/profile"
+)
+
+// runDiff compares the maps of two sides, each an adapter target, a file or
+// a cheat sheet URL.
+func runDiff(args []string, opts controller.ControllerOptions, connectTimeout time.Duration, w io.Writer) error {
+	diffFlags := flag.NewFlagSet("diff", flag.ExitOnError)
+
+	format := diffFlags.String("format", "auto", "Output format: text, color, json, or auto for color on terminals and text otherwise")
+
+	if err := diffFlags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	if diffFlags.NArg() != 2 {
+		return errors.New("diff needs two sides: adapter targets, files or cheat sheet URLs")
+	}
+
+	write := diff.WriteText
+	switch *format {
+	case "auto":
+		if isTerminal(w) {
+			write = diff.WriteColor
+		}
+	case "text":
+	case "color":
+		write = diff.WriteColor
+	case "json":
+		write = diff.WriteJSON
+	default:
+		return fmt.Errorf("invalid format %q", *format)
+	}
+
+	var sides [2][]controller.GamepadMap
+	for i, side := range diffFlags.Args() {
+		maps, err := loadMaps(side, opts, connectTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", side, err)
+		}
+		sides[i] = maps
+	}
+
+	return write(w, diff.Maps(sides[0], sides[1]))
+}
+
+// loadMaps reads the maps of a cheat sheet URL, of a profile, of a file
+// holding hex maps or a cheat sheet URL, or downloads them from the adapter
+// at target.
+func loadMaps(target string, opts controller.ControllerOptions, connectTimeout time.Duration) ([]controller.GamepadMap, error) {
+	if controller.IsCheatSheetURL(target) {
+		return controller.ParseCheatSheetURL(target)
+	}
+
+	if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() {
+		if profile.IsProfile(target) {
+			p, err := profile.Load(target)
+			if err != nil {
+				return nil, err
+			}
+			return p.GamepadMaps(), nil
+		}
+
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return nil, err
+		}
+
+		content := strings.TrimSpace(string(data))
+		if controller.IsCheatSheetURL(content) {
+			return controller.ParseCheatSheetURL(content)
+		}
+		return controller.ParseGamepadMaps(content)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if connectTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+	}
+	c, err := controller.OpenWithOptions(ctx, target, opts)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return c.Download()
+}
+
+// isTerminal reports whether w is a terminal rather than a file or pipe.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
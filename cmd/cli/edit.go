@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"snes2c64gui/pkg/controller"
+)
+
+// editMap applies the button edits of the u command to g, in this order:
+// clear unmaps buttons, e.g. "L+R", remove takes functions from buttons, e.g.
+// "B=AutoFire", and set replaces the functions of buttons, e.g.
+// "B=Fire1+AutoFire,Up=JoyUp". Names are those of SNESButton and
+// C64Function.
+func editMap(g *controller.GamepadMap, set, remove, clear string) error {
+	if clear != "" {
+		buttons, err := controller.ParseSNESButton(clear)
+		if err != nil {
+			return err
+		}
+		g.Clear(buttons)
+	}
+
+	removals, err := parseAssignments(remove)
+	if err != nil {
+		return err
+	}
+	for _, a := range removals {
+		g.Remove(a.buttons, a.functions)
+	}
+
+	sets, err := parseAssignments(set)
+	if err != nil {
+		return err
+	}
+	for _, a := range sets {
+		g.Set(a.buttons, a.functions)
+	}
+
+	return nil
+}
+
+type assignment struct {
+	buttons   controller.SNESButton
+	functions controller.C64Function
+}
+
+// parseAssignments parses comma separated "buttons=functions" pairs.
+func parseAssignments(s string) ([]assignment, error) {
+	var assignments []assignment
+
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		buttons, functions, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid assignment %q, want buttons=functions", pair)
+		}
+
+		var (
+			a   assignment
+			err error
+		)
+		if a.buttons, err = controller.ParseSNESButton(buttons); err != nil {
+			return nil, err
+		}
+		if a.functions, err = controller.ParseC64Function(functions); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+
+	return assignments, nil
+}
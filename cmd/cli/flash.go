@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/flasher"
+)
+
+func runFlash(args []string, target string, opts controller.ControllerOptions) {
+	flashFlags := flag.NewFlagSet("flash", flag.ExitOnError)
+
+	baudRate := flashFlags.Int("bootloader-baud", flasher.DefaultBaudRate, "Baud rate of the bootloader (57600 for Nanos with the old bootloader)")
+	verify := flashFlags.Bool("verify", true, "Read the flash back and compare it after writing")
+	backup := flashFlags.Bool("backup", true, "Save the maps before flashing and restore them afterwards")
+
+	if err := flashFlags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	if flashFlags.NArg() != 1 {
+		log.Fatalf("usage: flash [flags] FILE.hex")
+	}
+
+	img, err := flasher.ReadHexFile(flashFlags.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to read firmware: %v", err)
+	}
+	fmt.Printf("Flashing %d bytes to %s\n", img.Size(), target)
+
+	info, err := flasher.Update(context.Background(), target, img, flasher.Options{
+		BaudRate:   *baudRate,
+		SkipVerify: !*verify,
+		SkipBackup: !*backup,
+		Controller: opts,
+		OnProgress: func(p flasher.Progress) {
+			fmt.Printf("\r%-8s %3d%%", p.Stage, p.Done*100/p.Total)
+			if p.Done == p.Total {
+				fmt.Println()
+			}
+		},
+	})
+	if err != nil {
+		log.Fatalf("failed to flash: %v", err)
+	}
+
+	fmt.Println(info)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/lint"
+)
+
+// lintArgs are the parsed flags of the lint command.
+type lintArgs struct {
+	maps []controller.GamepadMap
+	min  lint.Severity
+}
+
+// parseLintArgs parses the flags of the lint command. It needs no adapter, so
+// -h and invalid flags fail before connecting.
+func parseLintArgs(args []string) (lintArgs, error) {
+	lintFlags := flag.NewFlagSet("lint", flag.ExitOnError)
+
+	mapsData := lintFlags.String("maps", "", "Maps to check instead of those of the adapter, as comma separated or concatenated hex like in the cheat sheet URL")
+	minSeverity := lintFlags.String("severity", lint.Info.String(), "Lowest severity to report (info, warning, error)")
+
+	if err := lintFlags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	var a lintArgs
+	switch *minSeverity {
+	case lint.Info.String():
+		a.min = lint.Info
+	case lint.Warning.String():
+		a.min = lint.Warning
+	case lint.Error.String():
+		a.min = lint.Error
+	default:
+		return a, fmt.Errorf("invalid severity %q", *minSeverity)
+	}
+
+	if *mapsData != "" {
+		maps, err := controller.ParseGamepadMaps(*mapsData)
+		if err != nil {
+			return a, fmt.Errorf("invalid maps: %w", err)
+		}
+		a.maps = maps
+	}
+
+	return a, nil
+}
+
+// runLint checks the maps given with -maps or, without, those downloaded
+// with download.
+func runLint(args []string, download func() ([]controller.GamepadMap, error), w io.Writer) error {
+	a, err := parseLintArgs(args)
+	if err != nil {
+		return err
+	}
+
+	return a.run(download, w)
+}
+
+func (a lintArgs) run(download func() ([]controller.GamepadMap, error), w io.Writer) error {
+	maps := a.maps
+	if maps == nil {
+		var err error
+		if maps, err = download(); err != nil {
+			return fmt.Errorf("failed to download: %w", err)
+		}
+	}
+
+	findings := lint.Maps(maps)
+	for _, f := range findings {
+		if f.Severity >= a.min {
+			fmt.Fprintln(w, f)
+		}
+	}
+
+	if lint.Max(findings) >= lint.Error {
+		return errors.New("lint found errors")
+	}
+
+	return nil
+}
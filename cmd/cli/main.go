@@ -1,79 +1,141 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"log"
-	"regexp"
+	"os"
 	"snes2c64gui/pkg/controller"
-	"strconv"
+	"strings"
 )
 
 func main() {
-	serialPort := flag.String("serial", "/dev/ttyUSB0", "Serial port to use")
+	serialPort := flag.String("serial", "/dev/ttyUSB0", "Serial port or transport URL (serial://, tcp://, rfc2217://, pty://, mem://, replay://) to use, or auto to detect the adapter. A comma separated list runs the command on every adapter")
+	all := flag.Bool("all", false, "Run the command on every connected adapter")
+	connectTimeout := flag.Duration("connect-timeout", controller.DefaultTimeouts.Connect, "Time to wait for the adapter to boot (0 disables)")
+	versionTimeout := flag.Duration("version-timeout", controller.DefaultTimeouts.Version, "Timeout of the firmware version command (0 disables)")
+	downloadTimeout := flag.Duration("download-timeout", controller.DefaultTimeouts.Download, "Timeout of the download command (0 disables)")
+	uploadTimeout := flag.Duration("upload-timeout", controller.DefaultTimeouts.Upload, "Timeout of the upload command (0 disables)")
+	reconnect := flag.Bool("reconnect", false, "Reopen the port and repeat the command when the connection breaks")
+	reset := flag.String("reset", string(controller.ResetAuto), "Whether connecting resets the adapter: auto waits for the boot banner and asks for the version if none arrives, none holds DTR and never resets")
+	bannerWindow := flag.Duration("banner-window", controller.DefaultBannerWindow, "Time to wait for the boot banner in reset mode auto")
+	protocol := flag.String("protocol", string(controller.ProtocolAuto), "Protocol to speak: auto uses the checksummed framed protocol if the firmware offers it, text the legacy commands, framed fails on older firmware")
+	traceFile := flag.String("trace", "", "Record the bytes sent to and received from the adapter to this file (JSON lines, replay with -serial replay://FILE)")
+	serial := addSerialFlags(flag.CommandLine)
 	flag.Parse()
 
-	c, err := controller.NewController(*serialPort)
-	if err != nil {
-		log.Fatalf("failed to create controller: %v", err)
+	args := flag.Args()
+	if len(args) > 0 {
+		switch args[0] {
+		case "ports":
+			runPorts(args[1:], *connectTimeout)
+			return
+		case "wait-for-device":
+			runWaitForDevice(args[1:])
+			return
+		case "profile":
+			if done, err := runProfileFile(args[1:], os.Stdout); done {
+				if err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		case "lint":
+			lintArgs, err := parseLintArgs(args[1:])
+			if err != nil {
+				log.Fatal(err)
+			}
+			// maps given on the command line need no adapter
+			if lintArgs.maps != nil {
+				if err := lintArgs.run(nil, os.Stdout); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		}
 	}
-	defer c.Close()
 
-	firmwareVersionString, err := c.GetFirmwareVersion()
+	opts := controller.ControllerOptions{
+		Timeouts: &controller.Timeouts{
+			Connect:  *connectTimeout,
+			Version:  *versionTimeout,
+			Download: *downloadTimeout,
+			Upload:   *uploadTimeout,
+		},
+	}
+	serialSettings, err := serial.settings()
 	if err != nil {
-		log.Fatalf("failed to get firmware version: %v", err)
+		log.Fatalf("invalid serial settings: %v", err)
 	}
-	fmt.Println(firmwareVersionString)
-	fmt.Println()
+	opts.Serial = &serialSettings
 
-	args := flag.Args()
-	if len(args) > 0 && args[0] == "u" {
-		uploadFlags := flag.NewFlagSet("u", flag.ExitOnError)
+	if opts.Reset, err = controller.ParseResetMode(*reset); err != nil {
+		log.Fatalf("invalid reset mode: %v", err)
+	}
+	opts.BannerWindow = *bannerWindow
 
-		mapPosition := uploadFlags.Int("mapPos", -1, "Map positon")
-		mapData := uploadFlags.String("map", "", "Map")
+	if opts.Protocol, err = controller.ParseProtocol(*protocol); err != nil {
+		log.Fatalf("invalid protocol: %v", err)
+	}
 
-		if err := uploadFlags.Parse(args[1:]); err != nil {
-			panic(err)
-		}
+	if len(args) > 0 && args[0] == "serve-serial" {
+		runServeSerial(args[1:], *serialPort, serialSettings, opts.Reset)
+		return
+	}
 
-		if *mapPosition == -1 {
-			log.Fatalf("mapPos is required")
+	if *reconnect {
+		policy := controller.DefaultReconnectPolicy
+		opts.Reconnect = &policy
+		opts.OnStateChange = func(s controller.ConnectionState) {
+			log.Printf("adapter %s", s)
 		}
+	}
 
-		const hexRegex = `^[0-9A-Fa-f]{20}$`
-		hexRegexCompiled := regexp.MustCompile(hexRegex)
-		if !hexRegexCompiled.MatchString(*mapData) {
-			log.Fatalf("map must match %s", hexRegex)
+	if len(args) > 0 && args[0] == "diff" {
+		if err := runDiff(args[1:], opts, *connectTimeout, os.Stdout); err != nil {
+			log.Fatal(err)
 		}
+		return
+	}
 
-		var gamepadMap controller.GamepadMap
-		for i := 0; i < 10; i++ {
-			btn := (*mapData)[i*2 : i*2+2]
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatalf("failed to create trace file: %v", err)
+		}
+		defer f.Close()
 
-			btnUInt, err := strconv.ParseUint(btn, 16, 8)
-			if err != nil {
-				log.Fatalf("failed to parse button: %v", err)
-			}
+		opts.Trace = f
+	}
 
-			gamepadMap[i] = uint8(btnUInt)
+	targets := strings.Split(*serialPort, ",")
+	if len(targets) > 1 || *all {
+		if opts.Trace != nil {
+			log.Fatalf("-trace records a single adapter")
 		}
-
-		if err := c.Upload(uint8(*mapPosition), gamepadMap); err != nil {
-			log.Fatalf("failed to upload: %v", err)
+		if err := runMulti(targets, *all, args, opts, *connectTimeout); err != nil {
+			log.Fatal(err)
 		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "flash" {
+		runFlash(args[1:], *serialPort, opts)
+		return
 	}
 
-	maps, err := c.Download()
+	ctx, cancel := context.WithCancel(context.Background())
+	if *connectTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *connectTimeout)
+	}
+	c, err := controller.OpenWithOptions(ctx, *serialPort, opts)
+	cancel()
 	if err != nil {
-		log.Fatalf("failed to download: %v", err)
+		log.Fatalf("failed to create controller: %v", err)
 	}
+	defer c.Close()
 
-	for i, m := range maps {
-		fmt.Printf("%d: ", i)
-		for _, b := range m {
-			fmt.Printf("%02X", b)
-		}
-		fmt.Println()
+	if err := runCommand(c, args, os.Stdout); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+)
+
+// runMulti runs the command in args on every target in parallel and prints
+// the results per adapter. With all it runs the command on every adapter
+// detected instead, keeping the connections of the probes.
+func runMulti(targets []string, all bool, args []string, opts controller.ControllerOptions, connectTimeout time.Duration) error {
+	if len(args) > 0 && args[0] == "flash" {
+		return errors.New("flash updates a single adapter at a time")
+	}
+	if len(args) > 1 && args[0] == "profile" && args[1] == "save" {
+		return errors.New("profile save reads a single adapter")
+	}
+
+	m := controller.NewManager(opts)
+	defer m.CloseAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if connectTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, connectTimeout)
+	}
+	var opened []controller.SessionResult
+	if all {
+		var err error
+		opened, err = m.OpenDetected(ctx, controller.DiscoverOptions{Timeout: connectTimeout})
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to detect adapters: %w", err)
+		}
+	} else {
+		opened = m.OpenAll(ctx, targets)
+	}
+	cancel()
+
+	var (
+		mu      sync.Mutex
+		outputs = map[string]*bytes.Buffer{}
+	)
+	results := m.Each(context.Background(), func(ctx context.Context, s *controller.Session) error {
+		out := &bytes.Buffer{}
+		mu.Lock()
+		outputs[s.Name] = out
+		mu.Unlock()
+
+		return runCommand(s.Controller, args, out)
+	})
+
+	for _, r := range results {
+		fmt.Printf("== %s\n%s", r.Session.Name, outputs[r.Session.Name])
+	}
+
+	failed := 0
+	for _, r := range append(opened, results...) {
+		if r.Err != nil {
+			failed++
+		}
+	}
+
+	fmt.Println("== results")
+	for _, r := range opened {
+		if r.Err != nil {
+			fmt.Printf("%s: failed to connect: %v\n", r.Session.Name, r.Err)
+		}
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("%s: %v\n", r.Session.Name, r.Err)
+		} else {
+			fmt.Printf("%s: ok\n", r.Session.Name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d adapters failed", failed, len(opened))
+	}
+
+	return nil
+}
+
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return arg != name+"=false"
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func runPorts(args []string, timeout time.Duration) {
+	portsFlags := flag.NewFlagSet("ports", flag.ExitOnError)
+
+	probe := portsFlags.Bool("probe", false, "Open every port and check whether an adapter answers")
+
+	if err := portsFlags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	if !*probe {
+		ports, err := controller.ListPorts()
+		if err != nil {
+			log.Fatalf("failed to list ports: %v", err)
+		}
+
+		for _, port := range ports {
+			fmt.Println(port)
+		}
+		return
+	}
+
+	candidates, err := controller.Discover(context.Background(), controller.DiscoverOptions{Timeout: timeout})
+	if err != nil {
+		log.Fatalf("failed to probe ports: %v", err)
+	}
+
+	for _, c := range candidates {
+		switch {
+		case c.Firmware != nil:
+			fmt.Printf("%s: adapter, %s\n", c.Port, c.Firmware)
+		case c.Found():
+			fmt.Printf("%s: adapter, version unknown: %v\n", c.Port, c.Err)
+		default:
+			fmt.Printf("%s: no adapter: %v\n", c.Port, c.Err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/lint"
+	"snes2c64gui/pkg/profile"
+)
+
+// runProfileFile runs the profile commands that need no adapter: schema and
+// show. It reports false for the others.
+func runProfileFile(args []string, w io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return true, errors.New("profile needs a command: schema, show, save or apply")
+	}
+
+	switch args[0] {
+	case "schema":
+		_, err := w.Write(profile.Schema)
+		return true, err
+	case "show":
+		if len(args) != 2 {
+			return true, errors.New("profile show needs a file")
+		}
+
+		p, err := profile.Load(args[1])
+		if err != nil {
+			return true, err
+		}
+
+		fmt.Fprintf(w, "%s", p.Name)
+		if p.Author != "" {
+			fmt.Fprintf(w, " by %s", p.Author)
+		}
+		fmt.Fprintln(w)
+		if p.Notes != "" {
+			fmt.Fprintln(w, p.Notes)
+		}
+		fmt.Fprintln(w)
+
+		for i, s := range p.Maps {
+			if s.Title != "" {
+				fmt.Fprintf(w, "%d: %s %s\n", i, s.Map.Hex(), s.Title)
+			} else {
+				fmt.Fprintf(w, "%d: %s\n", i, s.Map.Hex())
+			}
+			if s.Description != "" {
+				fmt.Fprintf(w, "   %s\n", strings.TrimSpace(s.Description))
+			}
+		}
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// runProfile saves the maps of the adapter behind c to a profile or applies
+// a profile to it.
+func runProfile(c *controller.Controller, info controller.FirmwareInfo, args []string, w io.Writer) error {
+	if done, err := runProfileFile(args, w); done {
+		return err
+	}
+
+	switch args[0] {
+	case "save":
+		saveFlags := flag.NewFlagSet("profile save", flag.ExitOnError)
+
+		name := saveFlags.String("name", "", "Profile name (default: the file name without extension)")
+		author := saveFlags.String("author", "", "Profile author")
+		notes := saveFlags.String("notes", "", "Profile notes")
+
+		if err := saveFlags.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+		if saveFlags.NArg() != 1 {
+			return errors.New("profile save needs a file")
+		}
+		path := saveFlags.Arg(0)
+
+		if err := info.Require(controller.FeatureDownload); err != nil {
+			return fmt.Errorf("cannot download: %w", err)
+		}
+
+		maps, err := c.Download()
+		if err != nil {
+			return fmt.Errorf("failed to download: %w", err)
+		}
+
+		if *name == "" {
+			*name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		p := profile.New(*name, maps)
+		p.Author = *author
+		p.Notes = *notes
+
+		if err := profile.Save(path, p); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "saved %d maps to %s\n", len(maps), path)
+	case "apply":
+		applyFlags := flag.NewFlagSet("profile apply", flag.ExitOnError)
+
+		force := applyFlags.Bool("force", false, "Apply even if lint finds errors in the maps")
+
+		if err := applyFlags.Parse(args[1:]); err != nil {
+			panic(err)
+		}
+		if applyFlags.NArg() != 1 {
+			return errors.New("profile apply needs a file")
+		}
+
+		if err := info.Require(controller.FeatureUpload); err != nil {
+			return fmt.Errorf("cannot upload: %w", err)
+		}
+
+		p, err := profile.Load(applyFlags.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		maps := p.GamepadMaps()
+		if err := checkLint(w, lint.Maps(maps), *force); err != nil {
+			return err
+		}
+
+		changed, err := c.ApplyAll(maps)
+		if err != nil {
+			return fmt.Errorf("failed to apply maps: %w", err)
+		}
+		fmt.Fprintf(w, "applied %s, updated maps %v\n", p.Name, changed)
+	default:
+		return fmt.Errorf("unknown profile command %q", args[0])
+	}
+
+	return nil
+}
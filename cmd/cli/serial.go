@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"snes2c64gui/pkg/controller"
+)
+
+type serialFlags struct {
+	baud     *string
+	dataBits *int
+	parity   *string
+	stopBits *string
+	dtr      *string
+	rts      *string
+}
+
+func addSerialFlags(fs *flag.FlagSet) *serialFlags {
+	d := controller.DefaultSerialSettings
+
+	return &serialFlags{
+		baud:     fs.String("baud", strconv.Itoa(d.BaudRate), "Baud rate of serial ports, or auto to try common rates until the adapter answers (allow for it in -connect-timeout)"),
+		dataBits: fs.Int("data-bits", d.DataBits, "Data bits of serial ports (5-8)"),
+		parity:   fs.String("parity", string(d.Parity), "Parity of serial ports (none, odd, even, mark, space)"),
+		stopBits: fs.String("stop-bits", string(d.StopBits), "Stop bits of serial ports (1, 1.5, 2)"),
+		dtr:      fs.String("dtr", string(d.DTR), "State of the DTR line after opening a serial port (on, off)"),
+		rts:      fs.String("rts", string(d.RTS), "State of the RTS line after opening a serial port (on, off)"),
+	}
+}
+
+func (f *serialFlags) settings() (controller.SerialSettings, error) {
+	baudRate, err := controller.ParseBaudRate(*f.baud)
+	if err != nil {
+		return controller.SerialSettings{}, err
+	}
+
+	return controller.SerialSettings{
+		BaudRate: baudRate,
+		DataBits: *f.dataBits,
+		Parity:   controller.Parity(*f.parity),
+		StopBits: controller.StopBits(*f.stopBits),
+		DTR:      controller.LineState(*f.dtr),
+		RTS:      controller.LineState(*f.rts),
+	}, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func runServeSerial(args []string, target string, settings controller.SerialSettings, reset controller.ResetMode) {
+	serveFlags := flag.NewFlagSet("serve-serial", flag.ExitOnError)
+
+	listen := serveFlags.String("listen", "localhost:2217", "Address to accept clients on. Clients are not authenticated, so only give an address reachable from other hosts, e.g. :2217, on trusted networks")
+	mode := serveFlags.String("mode", string(controller.BridgeRaw), "Protocol for the clients: raw for tcp:// targets, rfc2217 for rfc2217:// targets, which also carry the serial settings")
+
+	if err := serveFlags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	bridgeMode, err := controller.ParseBridgeMode(*mode)
+	if err != nil {
+		log.Fatalf("invalid mode: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		log.Printf("warning: %s is reachable from other hosts without authentication", ln.Addr())
+	}
+
+	scheme := controller.SchemeTCP
+	if bridgeMode == controller.BridgeRFC2217 {
+		scheme = controller.SchemeRFC2217
+	}
+	log.Printf("sharing %s as %s://%s", target, scheme, ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = controller.ServeBridge(ctx, ln, controller.BridgeOptions{
+		Target: target,
+		Mode:   bridgeMode,
+		Serial: settings,
+		Reset:  reset,
+		Logf:   log.Printf,
+	})
+	if err != nil {
+		log.Fatalf("failed to serve %s: %v", target, err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func runWaitForDevice(args []string) {
+	waitFlags := flag.NewFlagSet("wait-for-device", flag.ExitOnError)
+
+	timeout := waitFlags.Duration("timeout", 0, "Give up after this duration (0 waits forever)")
+	anyPort := waitFlags.Bool("any", false, "Wait for any serial port instead of known adapter USB chips")
+	interval := waitFlags.Duration("interval", controller.DefaultWatchInterval, "Interval between two port enumerations")
+
+	if err := waitFlags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	opts := controller.WatcherOptions{
+		Interval: *interval,
+	}
+	if *anyPort {
+		opts.Filter = func(controller.PortInfo) bool { return true }
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+	}
+	defer cancel()
+
+	port, err := controller.WaitForDevice(ctx, opts)
+	if err != nil {
+		log.Fatalf("failed to wait for device: %v", err)
+	}
+
+	fmt.Println(port.Name)
+}
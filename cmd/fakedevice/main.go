@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"snes2c64gui/pkg/emulator"
+	"snes2c64gui/pkg/flasher"
+)
+
+func main() {
+	version := flag.String("version", emulator.DefaultVersion, "Firmware version to emulate")
+	eepromFile := flag.String("eeprom", "", "File to persist the map slots in")
+	bootDelay := flag.Duration("boot-delay", 500*time.Millisecond, "Delay between opening the port and the setup banner")
+	noReset := flag.Bool("no-reset", false, "Do not reboot on a new connection, so no banner is printed")
+	bootloader := flag.Bool("bootloader", false, "Run an STK500 bootloader after every reset, so the firmware can be flashed")
+	link := flag.String("link", "", "Optional symlink to create for the pty, e.g. /tmp/ttySNES")
+	flag.Parse()
+
+	opts := emulator.Options{
+		Version:    *version,
+		EEPROMFile: *eepromFile,
+		BootDelay:  *bootDelay,
+		NoReset:    *noReset,
+	}
+	if *bootloader {
+		opts.Bootloader = emulator.NewBootloader(flasher.ATmega328P)
+	}
+
+	e, err := emulator.New(opts)
+	if err != nil {
+		log.Fatalf("failed to create emulator: %v", err)
+	}
+
+	p, err := openPTY()
+	if err != nil {
+		log.Fatalf("failed to create pty: %v", err)
+	}
+	defer p.Close()
+
+	if *link != "" {
+		if err := os.Symlink(p.Name, *link); err != nil {
+			log.Fatalf("failed to create link: %v", err)
+		}
+		defer os.Remove(*link)
+	}
+
+	fmt.Println(p.Name)
+
+	go func() {
+		for {
+			if err := p.WaitOpen(); err != nil {
+				log.Fatalf("failed to wait for client: %v", err)
+			}
+
+			log.Printf("client connected, firmware %s booting", *version)
+			if err := e.Serve(p.Session()); err != nil {
+				log.Printf("session failed: %v", err)
+			}
+			log.Printf("client disconnected")
+		}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+}
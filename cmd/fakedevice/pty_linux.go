@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// pty is the master side of a Linux pseudo-terminal. The slave side, whose
+// path is Name, is what the GUI and CLI open as serial port.
+type pty struct {
+	master *os.File
+	Name   string
+}
+
+func openPTY() (*pty, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open /dev/ptmx: %w", err)
+	}
+
+	fd := int(master.Fd())
+
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to unlock pty: %w", err)
+	}
+
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to get pty number: %w", err)
+	}
+
+	p := &pty{
+		master: master,
+		Name:   fmt.Sprintf("/dev/pts/%d", n),
+	}
+
+	if err := p.makeRaw(); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// makeRaw switches the slave to raw mode, so the emulator output reaches
+// clients unmodified even before they configure the port themselves.
+func (p *pty) makeRaw() error {
+	slave, err := os.OpenFile(p.Name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", p.Name, err)
+	}
+	defer slave.Close()
+
+	fd := int(slave.Fd())
+
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return fmt.Errorf("failed to get terminal settings: %w", err)
+	}
+
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB
+	t.Cflag |= unix.CS8
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, t); err != nil {
+		return fmt.Errorf("failed to set terminal settings: %w", err)
+	}
+
+	return nil
+}
+
+// WaitOpen blocks until a client has opened the slave side.
+func (p *pty) WaitOpen() error {
+	for {
+		hup, err := p.hangup()
+		if err != nil {
+			return err
+		}
+		if !hup {
+			return nil
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Session returns a connection that reports io.EOF once the client has
+// closed the slave side.
+func (p *pty) Session() io.ReadWriter {
+	return &ptySession{p}
+}
+
+func (p *pty) Close() error {
+	return p.master.Close()
+}
+
+func (p *pty) hangup() (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(p.master.Fd()), Events: unix.POLLIN}}
+
+	if _, err := unix.Poll(fds, 0); err != nil && !errors.Is(err, unix.EINTR) {
+		return false, fmt.Errorf("failed to poll pty: %w", err)
+	}
+
+	return fds[0].Revents&unix.POLLHUP != 0, nil
+}
+
+type ptySession struct {
+	p *pty
+}
+
+func (s *ptySession) Read(b []byte) (int, error) {
+	n, err := s.p.master.Read(b)
+	if errors.Is(err, unix.EIO) {
+		return n, io.EOF
+	}
+
+	return n, err
+}
+
+func (s *ptySession) Write(b []byte) (int, error) {
+	hup, err := s.p.hangup()
+	if err != nil {
+		return 0, err
+	}
+	if hup {
+		return 0, io.EOF
+	}
+
+	return s.p.master.Write(b)
+}
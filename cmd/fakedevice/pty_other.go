@@ -0,0 +1,28 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+type pty struct {
+	Name string
+}
+
+func openPTY() (*pty, error) {
+	return nil, errors.New("pseudo-terminals are only supported on Linux")
+}
+
+func (p *pty) WaitOpen() error {
+	return nil
+}
+
+func (p *pty) Session() io.ReadWriter {
+	return nil
+}
+
+func (p *pty) Close() error {
+	return nil
+}
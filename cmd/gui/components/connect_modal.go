@@ -1,13 +1,17 @@
 package components
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"go.bug.st/serial"
+
+	"snes2c64gui/pkg/controller"
 )
 
 type ConnectModal struct {
@@ -16,6 +20,9 @@ type ConnectModal struct {
 	OnConnect func(port string)
 
 	serialPortButtonGrid *fyne.Container
+	autoDetectButton     *widget.Button
+	remoteEntry          *widget.Entry
+	statusLabel          *widget.Label
 }
 
 func NewConnectModal(parent fyne.Canvas, onConnect func(port string)) *ConnectModal {
@@ -28,14 +35,32 @@ func NewConnectModal(parent fyne.Canvas, onConnect func(port string)) *ConnectMo
 		modal.Show()
 	})
 
+	c.autoDetectButton = widget.NewButtonWithIcon("Auto-detect", theme.SearchIcon(), func() {
+		c.AutoDetect()
+	})
+	c.statusLabel = widget.NewLabel("")
+
+	c.remoteEntry = widget.NewEntry()
+	c.remoteEntry.SetPlaceHolder("tcp://host:port or rfc2217://host:port")
+	c.remoteEntry.OnSubmitted = func(string) {
+		c.ConnectRemote()
+	}
+	remoteButton := widget.NewButton("Connect", func() {
+		c.ConnectRemote()
+	})
+
 	modal.Content = container.NewVBox(
 		container.NewHBox(
 			widget.NewLabel("Select a serial port"),
 			widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), func() {
 				c.RefreshPorts()
 			}),
+			c.autoDetectButton,
 		),
 		portsGrid,
+		widget.NewLabel("or a remote adapter shared with serve-serial"),
+		container.NewBorder(nil, nil, nil, remoteButton, c.remoteEntry),
+		c.statusLabel,
 	)
 
 	c.Button = open
@@ -47,21 +72,69 @@ func NewConnectModal(parent fyne.Canvas, onConnect func(port string)) *ConnectMo
 }
 
 func (c *ConnectModal) RefreshPorts() {
-	serialPorts, err := serial.GetPortsList()
+	c.serialPortButtonGrid.Objects = nil
+
+	serialPorts, err := controller.ListPorts()
 	if err != nil {
-		// TODO: Handle error in ui
-		panic(fmt.Sprintf("Error getting serial ports: %v", err))
+		c.statusLabel.SetText(fmt.Sprintf("Error getting serial ports: %v", err))
+		return
 	}
 
-	c.serialPortButtonGrid.Objects = nil
-
 	for i := range serialPorts {
 		port := serialPorts[i]
 
-		portButton := widget.NewButton(port, func() {
+		label := port.Name
+		if chip := port.Chip(); chip != "" {
+			label = fmt.Sprintf("%s (%s)", port.Name, chip)
+		}
+
+		portButton := widget.NewButton(label, func() {
 			c.Modal.Hide()
-			c.OnConnect(port)
+			c.OnConnect(port.Name)
 		})
+		if port.LikelyAdapter() {
+			portButton.Importance = widget.HighImportance
+		}
 		c.serialPortButtonGrid.Add(portButton)
 	}
+	c.serialPortButtonGrid.Refresh()
+}
+
+// ConnectRemote connects to the target in the remote entry.
+func (c *ConnectModal) ConnectRemote() {
+	target := strings.TrimSpace(c.remoteEntry.Text)
+
+	scheme, address := controller.SplitTarget(target)
+	if (scheme != controller.SchemeTCP && scheme != controller.SchemeRFC2217) || address == "" {
+		c.statusLabel.SetText("Enter a remote adapter like tcp://raspberrypi:2217")
+		return
+	}
+
+	c.statusLabel.SetText("")
+	c.Modal.Hide()
+	c.OnConnect(target)
+}
+
+// AutoDetect probes all serial ports and connects to the best adapter.
+func (c *ConnectModal) AutoDetect() {
+	c.autoDetectButton.Disable()
+	c.statusLabel.SetText("Searching for adapters...")
+
+	go func() {
+		defer c.autoDetectButton.Enable()
+
+		port, err := controller.DiscoverBest(context.Background(), controller.DiscoverOptions{})
+		if errors.Is(err, controller.ErrNoAdapter) {
+			c.statusLabel.SetText("No adapter found, is it plugged in?")
+			return
+		}
+		if err != nil {
+			c.statusLabel.SetText(fmt.Sprintf("Error detecting adapter: %v", err))
+			return
+		}
+
+		c.statusLabel.SetText("")
+		c.Modal.Hide()
+		c.OnConnect(port.Name)
+	}()
 }
@@ -0,0 +1,167 @@
+package components
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/flasher"
+)
+
+// FlashOptions are the choices made in the FlashWizard.
+type FlashOptions struct {
+	Backup bool
+	Verify bool
+}
+
+// FlashWizard guides through updating the adapter firmware: choosing the
+// HEX file, the options, the progress and the result.
+type FlashWizard struct {
+	Button  *widget.Button
+	Modal   *widget.PopUp
+	OnFlash func(img *flasher.Image, opts FlashOptions, progress func(flasher.Progress)) (controller.FirmwareInfo, error)
+
+	window  fyne.Window
+	content *fyne.Container
+	img     *flasher.Image
+}
+
+func NewFlashWizard(window fyne.Window, onFlash func(img *flasher.Image, opts FlashOptions, progress func(flasher.Progress)) (controller.FirmwareInfo, error)) *FlashWizard {
+	w := &FlashWizard{
+		OnFlash: onFlash,
+		window:  window,
+		content: container.NewMax(),
+	}
+
+	w.Modal = widget.NewModalPopUp(w.content, window.Canvas())
+	w.Button = widget.NewButton("Update firmware", func() {
+		w.img = nil
+		w.showChoose()
+		w.Modal.Show()
+	})
+
+	return w
+}
+
+func (w *FlashWizard) show(step fyne.CanvasObject) {
+	w.content.Objects = []fyne.CanvasObject{step}
+	w.content.Refresh()
+	w.Modal.Resize(w.Modal.MinSize())
+}
+
+func (w *FlashWizard) showChoose() {
+	fileLabel := widget.NewLabel("No file chosen")
+
+	next := widget.NewButton("Next", func() {
+		w.showOptions()
+	})
+	next.Disable()
+
+	choose := widget.NewButton("Choose firmware...", func() {
+		open := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil {
+				fileLabel.SetText(fmt.Sprintf("Error opening firmware: %v", err))
+				return
+			}
+			if r == nil {
+				return
+			}
+			defer r.Close()
+
+			img, err := flasher.ParseHex(r)
+			if err != nil {
+				fileLabel.SetText(fmt.Sprintf("Error reading firmware: %v", err))
+				next.Disable()
+				return
+			}
+
+			w.img = img
+			fileLabel.SetText(fmt.Sprintf("%s (%d bytes)", r.URI().Name(), img.Size()))
+			next.Enable()
+		}, w.window)
+		open.SetFilter(storage.NewExtensionFileFilter([]string{".hex"}))
+		open.Show()
+	})
+
+	w.show(container.NewVBox(
+		widget.NewLabelWithStyle("Update firmware: 1/3", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewLabel("Choose the firmware image (Intel HEX)."),
+		choose,
+		fileLabel,
+		container.NewGridWithColumns(2,
+			widget.NewButton("Cancel", w.Modal.Hide),
+			next,
+		),
+	))
+}
+
+func (w *FlashWizard) showOptions() {
+	backup := widget.NewCheck("Back up the maps and restore them afterwards", nil)
+	backup.SetChecked(true)
+	verify := widget.NewCheck("Verify the written firmware", nil)
+	verify.SetChecked(true)
+
+	w.show(container.NewVBox(
+		widget.NewLabelWithStyle("Update firmware: 2/3", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		backup,
+		verify,
+		widget.NewLabel("Do not unplug the adapter while flashing."),
+		container.NewGridWithColumns(2,
+			widget.NewButton("Back", w.showChoose),
+			widget.NewButton("Flash", func() {
+				w.flash(FlashOptions{Backup: backup.Checked, Verify: verify.Checked})
+			}),
+		),
+	))
+}
+
+func (w *FlashWizard) flash(opts FlashOptions) {
+	stage := widget.NewLabel("Connecting...")
+	bar := widget.NewProgressBar()
+
+	w.show(container.NewVBox(
+		widget.NewLabelWithStyle("Update firmware: 3/3", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		stage,
+		bar,
+	))
+
+	go func() {
+		info, err := w.OnFlash(w.img, opts, func(p flasher.Progress) {
+			stage.SetText(progressText(p.Stage))
+			bar.SetValue(float64(p.Done) / float64(p.Total))
+		})
+
+		result := fmt.Sprintf("Firmware updated:\n%s", info)
+		if err != nil {
+			result = fmt.Sprintf("Error updating firmware: %v", err)
+		}
+
+		w.show(container.NewVBox(
+			widget.NewLabelWithStyle("Update firmware", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabel(result),
+			widget.NewButton("Close", w.Modal.Hide),
+		))
+	}()
+}
+
+func progressText(stage flasher.Stage) string {
+	switch stage {
+	case flasher.StageBackup:
+		return "Maps backed up"
+	case flasher.StageSync:
+		return "Bootloader found"
+	case flasher.StageWrite:
+		return "Writing firmware..."
+	case flasher.StageVerify:
+		return "Verifying firmware..."
+	case flasher.StageRestore:
+		return "Maps restored"
+	default:
+		return string(stage)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"snes2c64gui/cmd/gui/widgets"
 	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/lint"
 	"strings"
 
 	"fyne.io/fyne/v2"
@@ -19,26 +20,32 @@ import (
 
 type GamepadMapView struct {
 	Container *fyne.Container
+	// Warnings shows the lint findings of the edited map.
+	Warnings *widget.Label
 
 	selectedGamepadMap int
 	GamepadMaps        []controller.GamepadMap
 }
 
-var c64buttons = []string{
-	"joy_up",
-	"joy_down",
-	"joy_left",
-	"joy_right",
-	"btn_1",
-	"btn_2",
-	"btn_3",
-	"btn_a",
+var c64ButtonIcons = map[controller.C64Function]string{
+	controller.JoyUp:    "joy_up",
+	controller.JoyDown:  "joy_down",
+	controller.JoyLeft:  "joy_left",
+	controller.JoyRight: "joy_right",
+	controller.Fire1:    "btn_1",
+	controller.Fire2:    "btn_2",
+	controller.Fire3:    "btn_3",
+	controller.AutoFire: "btn_a",
 }
 
 //go:embed assets/*
 var assets embed.FS
 
 func NewGamepadMap(snesKeyImages []*canvas.Image) *GamepadMapView {
+	m := &GamepadMapView{
+		Warnings: widget.NewLabel(""),
+	}
+
 	// snesKeyCount is the number of keys existing on the snes controller
 	snesKeyCount := len(snesKeyImages)
 
@@ -53,7 +60,8 @@ func NewGamepadMap(snesKeyImages []*canvas.Image) *GamepadMapView {
 		gamepadMapColContainer.Add(widget.NewSeparator())
 
 		c64ButtonsContainer := container.NewVBox()
-		for _, button := range c64buttons {
+		for _, function := range controller.C64Functions {
+			button := c64ButtonIcons[function]
 			resource, _ := assets.Open(fmt.Sprintf("assets/c64_%s.svg.png", button))
 			b, err := io.ReadAll(resource)
 			if err != nil {
@@ -65,6 +73,9 @@ func NewGamepadMap(snesKeyImages []*canvas.Image) *GamepadMapView {
 
 			staticResource := fyne.NewStaticResource(fmt.Sprintf("c64_%s", button), b)
 			iconPressSwitch := widgets.NewIconPressSwitch(staticResource, 50, 50)
+			iconPressSwitch.OnToggled = func(bool) {
+				m.updateWarnings()
+			}
 
 			c64ButtonsContainer.Add(iconPressSwitch)
 		}
@@ -94,9 +105,9 @@ func NewGamepadMap(snesKeyImages []*canvas.Image) *GamepadMapView {
 	overlayText.Hide()
 	mainContainer.Add(overlayText)
 
-	return &GamepadMapView{
-		Container: mainContainer,
-	}
+	m.Container = mainContainer
+
+	return m
 }
 
 func (m *GamepadMapView) InfoOverlay(text string) {
@@ -119,31 +130,12 @@ func (m *GamepadMapView) ClearSelectedMap() {
 			button.(*widgets.IconPressSwitch).SetActive(false)
 		}
 	}
-}
-
-func (m *GamepadMapView) IsEmpty(index int) bool {
-	for i := range m.GamepadMaps[index] {
-		if m.GamepadMaps[index][i] != 0 && m.GamepadMaps[index][i] != 128 {
-			return true
-		}
-	}
 
-	return false
+	m.updateWarnings()
 }
 
 func (m *GamepadMapView) GetCheatSheetURL() string {
-	var builder strings.Builder
-	for _, gamepadMap := range m.GamepadMaps {
-		// gamepadMap is an array of 10 uint8 values
-		// add them as hex values to the builder
-		for _, value := range gamepadMap {
-			builder.WriteString(fmt.Sprintf("%02x", value))
-		}
-	}
-
-	baseURL := "https://snes2c64sheet.shnbk.de/#"
-
-	return fmt.Sprintf("%s%s", baseURL, builder.String())
+	return controller.CheatSheetURL(m.GamepadMaps)
 }
 
 func (m *GamepadMapView) ErrorOverlay(text string) {
@@ -209,13 +201,37 @@ func (m *GamepadMapView) SelectGamepadMap(index int) {
 
 	gamepadMap := m.GamepadMaps[index]
 
-	for i, number := range gamepadMap {
+	for i, snesButton := range controller.SNESButtons {
 		c64ButtonsContainer := m.getGamepadMapColContainers()[i].Objects[2].(*fyne.Container)
 
 		for j, button := range c64ButtonsContainer.Objects {
-			button.(*widgets.IconPressSwitch).SetActive(int(number)&pow2(j) != 0)
+			button.(*widgets.IconPressSwitch).SetActive(gamepadMap.Get(snesButton)&controller.C64Functions[j] != 0)
 		}
 	}
+
+	m.updateWarnings()
+}
+
+// Findings lints the edited map, including the comparison to the other
+// slots.
+func (m *GamepadMapView) Findings() []lint.Finding {
+	if m.selectedGamepadMap >= len(m.GamepadMaps) {
+		return lint.Map(m.Map())
+	}
+
+	maps := append([]controller.GamepadMap(nil), m.GamepadMaps...)
+	maps[m.selectedGamepadMap] = m.Map()
+
+	return lint.Slot(lint.Maps(maps), m.selectedGamepadMap)
+}
+
+func (m *GamepadMapView) updateWarnings() {
+	var lines []string
+	for _, f := range m.Findings() {
+		lines = append(lines, fmt.Sprintf("%s: %s", f.Severity, f.Message))
+	}
+
+	m.Warnings.SetText(strings.Join(lines, "\n"))
 }
 
 func (m *GamepadMapView) Map() controller.GamepadMap {
@@ -226,7 +242,7 @@ func (m *GamepadMapView) Map() controller.GamepadMap {
 
 		for j, button := range c64ButtonsContainer.Objects {
 			if button.(*widgets.IconPressSwitch).Active() {
-				gamepadMap[i] |= (uint8(pow2(j)))
+				gamepadMap.Add(controller.SNESButtons[i], controller.C64Functions[j])
 			}
 		}
 	}
@@ -234,14 +250,6 @@ func (m *GamepadMapView) Map() controller.GamepadMap {
 	return gamepadMap
 }
 
-func pow2(n int) int {
-	if n == 0 {
-		return 1
-	}
-
-	return 2 * pow2(n-1)
-}
-
 func (m *GamepadMapView) SetGamepadMaps(gamepadMaps []controller.GamepadMap) {
 	m.GamepadMaps = gamepadMaps
 
@@ -6,6 +6,8 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/widget"
+
+	"snes2c64gui/pkg/controller"
 )
 
 type SelectMapModal struct {
@@ -20,7 +22,8 @@ type SelectMapModal struct {
 type Map struct {
 	Number int
 	Icon   fyne.Resource
-	Empty  bool
+	// State is empty until the maps have been downloaded.
+	State controller.SlotState
 }
 
 func NewSelectMapModal(maps []Map, parent fyne.Canvas, onSelect func(layer Map)) *SelectMapModal {
@@ -62,12 +65,14 @@ func (s *SelectMapModal) Refresh() {
 	s.Modal.Content.(*fyne.Container).Objects[1].(*fyne.Container).Objects = nil
 
 	for i := range s.Maps {
-		var layerButton *widget.Button
+		label := fmt.Sprintf("Map %d", s.Maps[i].Number+1)
+		if s.Maps[i].State != "" {
+			label = fmt.Sprintf("Map %d (%s)", s.Maps[i].Number+1, s.Maps[i].State)
+		}
 
-		if s.Maps[i].Empty {
-			layerButton = widget.NewButtonWithIcon(fmt.Sprintf("Map %d", s.Maps[i].Number+1), s.Maps[i].Icon, s.HandleSelect(s.Maps[i]))
-		} else {
-			layerButton = widget.NewButtonWithIcon(fmt.Sprintf("Map %d (e)", s.Maps[i].Number+1), s.Maps[i].Icon, s.HandleSelect(s.Maps[i]))
+		layerButton := widget.NewButtonWithIcon(label, s.Maps[i].Icon, s.HandleSelect(s.Maps[i]))
+		if s.Maps[i].State == controller.SlotUnused {
+			layerButton.Importance = widget.LowImportance
 		}
 		s.Modal.Content.(*fyne.Container).Objects[1].(*fyne.Container).Add(layerButton)
 	}
@@ -0,0 +1,247 @@
+package components
+
+import (
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"snes2c64gui/pkg/controller"
+)
+
+const (
+	connectTimeoutPreference  = "connectTimeout"
+	versionTimeoutPreference  = "versionTimeout"
+	downloadTimeoutPreference = "downloadTimeout"
+	uploadTimeoutPreference   = "uploadTimeout"
+	reconnectPreference       = "reconnect"
+	recordSessionPreference   = "recordSession"
+	resetModePreference       = "resetMode"
+	baudRatePreference        = "baudRate"
+	dataBitsPreference        = "dataBits"
+	parityPreference          = "parity"
+	stopBitsPreference        = "stopBits"
+	dtrPreference             = "dtr"
+	rtsPreference             = "rts"
+)
+
+type SettingsModal struct {
+	Button *widget.Button
+	Modal  *widget.PopUp
+	OnSave func()
+
+	preferences fyne.Preferences
+
+	connectTimeoutEntry  *widget.Entry
+	versionTimeoutEntry  *widget.Entry
+	downloadTimeoutEntry *widget.Entry
+	uploadTimeoutEntry   *widget.Entry
+	reconnectCheck       *widget.Check
+	recordSessionCheck   *widget.Check
+	resetModeSelect      *widget.Select
+
+	baudRateSelect *widget.Select
+	dataBitsSelect *widget.Select
+	paritySelect   *widget.Select
+	stopBitsSelect *widget.Select
+	dtrSelect      *widget.Select
+	rtsSelect      *widget.Select
+}
+
+func NewSettingsModal(parent fyne.Canvas, preferences fyne.Preferences, onSave func()) *SettingsModal {
+	s := &SettingsModal{
+		preferences:          preferences,
+		OnSave:               onSave,
+		connectTimeoutEntry:  newDurationEntry(),
+		versionTimeoutEntry:  newDurationEntry(),
+		downloadTimeoutEntry: newDurationEntry(),
+		uploadTimeoutEntry:   newDurationEntry(),
+		reconnectCheck:       widget.NewCheck("Reconnect automatically", nil),
+		recordSessionCheck:   widget.NewCheck("Record session", nil),
+		resetModeSelect:      newStringSelect(controller.ResetAuto, controller.ResetNone),
+		baudRateSelect:       widget.NewSelect([]string{"auto", "4800", "9600", "19200", "38400", "57600", "115200"}, nil),
+		dataBitsSelect:       widget.NewSelect([]string{"5", "6", "7", "8"}, nil),
+		paritySelect:         newStringSelect(controller.ParityNone, controller.ParityOdd, controller.ParityEven, controller.ParityMark, controller.ParitySpace),
+		stopBitsSelect:       newStringSelect(controller.StopBits1, controller.StopBits1_5, controller.StopBits2),
+		dtrSelect:            newStringSelect(controller.LineOn, controller.LineOff),
+		rtsSelect:            newStringSelect(controller.LineOn, controller.LineOff),
+	}
+
+	modal := widget.NewModalPopUp(nil, parent)
+
+	form := widget.NewForm(
+		widget.NewFormItem("Connect timeout", s.connectTimeoutEntry),
+		widget.NewFormItem("Version timeout", s.versionTimeoutEntry),
+		widget.NewFormItem("Download timeout", s.downloadTimeoutEntry),
+		widget.NewFormItem("Upload timeout", s.uploadTimeoutEntry),
+		widget.NewFormItem("Connection", s.reconnectCheck),
+		widget.NewFormItem("Reset on connect", s.resetModeSelect),
+		widget.NewFormItem("Troubleshooting", s.recordSessionCheck),
+	)
+	form.SubmitText = "Save"
+	form.OnSubmit = func() {
+		s.save()
+		modal.Hide()
+
+		if s.OnSave != nil {
+			s.OnSave()
+		}
+	}
+	form.OnCancel = func() {
+		modal.Hide()
+	}
+
+	advanced := widget.NewAccordion(widget.NewAccordionItem("Advanced serial settings", widget.NewForm(
+		widget.NewFormItem("Baud rate", s.baudRateSelect),
+		widget.NewFormItem("Data bits", s.dataBitsSelect),
+		widget.NewFormItem("Parity", s.paritySelect),
+		widget.NewFormItem("Stop bits", s.stopBitsSelect),
+		widget.NewFormItem("DTR", s.dtrSelect),
+		widget.NewFormItem("RTS", s.rtsSelect),
+	)))
+
+	modal.Content = container.NewVBox(
+		widget.NewLabel("Settings (durations like 2s or 500ms, 0 disables)"),
+		advanced,
+		form,
+	)
+
+	s.Modal = modal
+	s.Button = widget.NewButton("Settings", func() {
+		s.load()
+		modal.Show()
+	})
+
+	return s
+}
+
+func (s *SettingsModal) Timeouts() controller.Timeouts {
+	return controller.Timeouts{
+		Connect:  s.duration(connectTimeoutPreference, controller.DefaultTimeouts.Connect),
+		Version:  s.duration(versionTimeoutPreference, controller.DefaultTimeouts.Version),
+		Download: s.duration(downloadTimeoutPreference, controller.DefaultTimeouts.Download),
+		Upload:   s.duration(uploadTimeoutPreference, controller.DefaultTimeouts.Upload),
+	}
+}
+
+// Reconnect reports whether a broken connection should be reopened. It is
+// opt-in.
+func (s *SettingsModal) Reconnect() bool {
+	return s.preferences.BoolWithFallback(reconnectPreference, false)
+}
+
+// ResetMode returns whether connecting may reset the adapter.
+func (s *SettingsModal) ResetMode() controller.ResetMode {
+	mode, err := controller.ParseResetMode(s.preferences.StringWithFallback(resetModePreference, string(controller.ResetAuto)))
+	if err != nil {
+		return controller.ResetAuto
+	}
+
+	return mode
+}
+
+// RecordSession reports whether the traffic with the adapter should be
+// recorded to a trace file on the next connect.
+func (s *SettingsModal) RecordSession() bool {
+	return s.preferences.BoolWithFallback(recordSessionPreference, false)
+}
+
+// SerialSettings returns the settings serial ports are opened with.
+func (s *SettingsModal) SerialSettings() controller.SerialSettings {
+	d := controller.DefaultSerialSettings
+
+	baudRate, err := controller.ParseBaudRate(s.preferences.StringWithFallback(baudRatePreference, strconv.Itoa(d.BaudRate)))
+	if err != nil {
+		baudRate = d.BaudRate
+	}
+
+	return controller.SerialSettings{
+		BaudRate: baudRate,
+		DataBits: s.preferences.IntWithFallback(dataBitsPreference, d.DataBits),
+		Parity:   controller.Parity(s.preferences.StringWithFallback(parityPreference, string(d.Parity))),
+		StopBits: controller.StopBits(s.preferences.StringWithFallback(stopBitsPreference, string(d.StopBits))),
+		DTR:      controller.LineState(s.preferences.StringWithFallback(dtrPreference, string(d.DTR))),
+		RTS:      controller.LineState(s.preferences.StringWithFallback(rtsPreference, string(d.RTS))),
+	}
+}
+
+func (s *SettingsModal) load() {
+	t := s.Timeouts()
+
+	s.connectTimeoutEntry.SetText(t.Connect.String())
+	s.versionTimeoutEntry.SetText(t.Version.String())
+	s.downloadTimeoutEntry.SetText(t.Download.String())
+	s.uploadTimeoutEntry.SetText(t.Upload.String())
+	s.reconnectCheck.SetChecked(s.Reconnect())
+	s.recordSessionCheck.SetChecked(s.RecordSession())
+	s.resetModeSelect.SetSelected(string(s.ResetMode()))
+
+	serial := s.SerialSettings()
+	if serial.BaudRate == controller.AutoBaud {
+		s.baudRateSelect.SetSelected("auto")
+	} else {
+		s.baudRateSelect.SetSelected(strconv.Itoa(serial.BaudRate))
+	}
+	s.dataBitsSelect.SetSelected(strconv.Itoa(serial.DataBits))
+	s.paritySelect.SetSelected(string(serial.Parity))
+	s.stopBitsSelect.SetSelected(string(serial.StopBits))
+	s.dtrSelect.SetSelected(string(serial.DTR))
+	s.rtsSelect.SetSelected(string(serial.RTS))
+}
+
+func (s *SettingsModal) save() {
+	s.setDuration(connectTimeoutPreference, s.connectTimeoutEntry.Text)
+	s.setDuration(versionTimeoutPreference, s.versionTimeoutEntry.Text)
+	s.setDuration(downloadTimeoutPreference, s.downloadTimeoutEntry.Text)
+	s.setDuration(uploadTimeoutPreference, s.uploadTimeoutEntry.Text)
+	s.preferences.SetBool(reconnectPreference, s.reconnectCheck.Checked)
+	s.preferences.SetBool(recordSessionPreference, s.recordSessionCheck.Checked)
+	s.preferences.SetString(resetModePreference, s.resetModeSelect.Selected)
+
+	s.preferences.SetString(baudRatePreference, s.baudRateSelect.Selected)
+	if dataBits, err := strconv.Atoi(s.dataBitsSelect.Selected); err == nil {
+		s.preferences.SetInt(dataBitsPreference, dataBits)
+	}
+	s.preferences.SetString(parityPreference, s.paritySelect.Selected)
+	s.preferences.SetString(stopBitsPreference, s.stopBitsSelect.Selected)
+	s.preferences.SetString(dtrPreference, s.dtrSelect.Selected)
+	s.preferences.SetString(rtsPreference, s.rtsSelect.Selected)
+}
+
+func (s *SettingsModal) duration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(s.preferences.StringWithFallback(key, fallback.String()))
+	if err != nil {
+		return fallback
+	}
+
+	return d
+}
+
+func (s *SettingsModal) setDuration(key string, text string) {
+	if _, err := time.ParseDuration(text); err != nil {
+		return
+	}
+
+	s.preferences.SetString(key, text)
+}
+
+func newStringSelect[T ~string](options ...T) *widget.Select {
+	o := make([]string, len(options))
+	for i, option := range options {
+		o[i] = string(option)
+	}
+
+	return widget.NewSelect(o, nil)
+}
+
+func newDurationEntry() *widget.Entry {
+	e := widget.NewEntry()
+	e.Validator = func(text string) error {
+		_, err := time.ParseDuration(text)
+		return err
+	}
+
+	return e
+}
@@ -12,7 +12,7 @@ import (
 
 func main() {
 
-	myApp := app.New()
+	myApp := app.NewWithID("de.shnbk.snes2c64")
 
 	myWindow := myApp.NewWindow("Snes2C64")
 	myWindow.Resize(fyne.NewSize(800, 600))
@@ -1,12 +1,15 @@
 package views
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"io"
+	"log"
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	_ "embed"
@@ -14,19 +17,29 @@ import (
 	fyne "fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 
 	"snes2c64gui/cmd/gui/components"
 	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/flasher"
+	"snes2c64gui/pkg/lint"
+	"snes2c64gui/pkg/profile"
 )
 
 type UploadView struct {
 	Controller *controller.Controller
 
+	window fyne.Window
+
 	ConnectModal *components.ConnectModal
 
+	SettingsModal *components.SettingsModal
+
+	FlashWizard *components.FlashWizard
+
 	GamepadMapView *components.GamepadMapView
 
 	SelectLayerModal *components.SelectMapModal
@@ -34,8 +47,33 @@ type UploadView struct {
 	UploadButton     *widget.Button
 
 	PrintCheatSheetButton *widget.Button
+	OpenProfileButton     *widget.Button
+	SaveProfileButton     *widget.Button
 
 	VersionLabel *widget.Label
+
+	// Devices holds a session per connected adapter, DeviceSelect switches
+	// between them.
+	Devices          *controller.Manager
+	DeviceSelect     *widget.Select
+	DisconnectButton *widget.Button
+
+	// port is the port of the shown session, lastPort the one shown most
+	// recently, which the firmware is flashed to. deviceMu guards them and
+	// Controller, which the hot-plug watcher changes while the UI uses them.
+	deviceMu       sync.Mutex
+	port, lastPort string
+
+	// firmwareInfo describes the firmware of the shown adapter.
+	firmwareInfo controller.FirmwareInfo
+
+	// profile is the profile opened last, whose description is kept when
+	// the maps are saved again.
+	profile *profile.Profile
+
+	// traces receive the recorded sessions by port, if recording is enabled.
+	mu     sync.Mutex
+	traces map[string]fyne.URIWriteCloser
 }
 
 //go:embed assets/*
@@ -52,31 +90,42 @@ var selectMapModalMapIcons = []string{
 	"snes_button_x-full",
 }
 
-var keyIconNames = []string{
-	"dpad_up",
-	"dpad_down",
-	"dpad_left",
-	"dpad_right",
-	"snes_button_b-full",
-	"snes_button_a-full",
-	"snes_button_y-full",
-	"snes_button_x-full",
-	"snes_shoulder_l",
-	"snes_shoulder_R",
+var keyIconNames = map[controller.SNESButton]string{
+	controller.ButtonUp:    "dpad_up",
+	controller.ButtonDown:  "dpad_down",
+	controller.ButtonLeft:  "dpad_left",
+	controller.ButtonRight: "dpad_right",
+	controller.ButtonB:     "snes_button_b-full",
+	controller.ButtonA:     "snes_button_a-full",
+	controller.ButtonY:     "snes_button_y-full",
+	controller.ButtonX:     "snes_button_x-full",
+	controller.ButtonL:     "snes_shoulder_l",
+	controller.ButtonR:     "snes_shoulder_R",
 }
 
 func NewUploadView(window fyne.Window) (uv *UploadView) {
 	connectModal := components.NewConnectModal(window.Canvas(), func(port string) {
-		handleConnect(uv, uv.Controller, port)()
+		handleConnect(uv, port)()
 	})
 	window.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyC, Modifier: fyne.KeyModifierAlt}, func(shortcut fyne.Shortcut) {
 		connectModal.RefreshPorts()
 		connectModal.Modal.Show()
 	})
 
+	settingsModal := components.NewSettingsModal(window.Canvas(), fyne.CurrentApp().Preferences(), func() {
+		for _, s := range uv.Devices.Sessions() {
+			s.Controller.SetTimeouts(uv.SettingsModal.Timeouts())
+		}
+	})
+
+	flashWizard := components.NewFlashWizard(window, func(img *flasher.Image, opts components.FlashOptions, progress func(flasher.Progress)) (controller.FirmwareInfo, error) {
+		return uv.flashFirmware(img, opts, progress)
+	})
+	flashWizard.Button.Disable()
+
 	maps := make([]components.Map, len(selectMapModalMapIcons))
 
-	keysIcons := make([]*canvas.Image, 10)
+	keysIcons := make([]*canvas.Image, len(controller.SNESButtons))
 
 	for i, icon := range selectMapModalMapIcons {
 		resource, err := assets.Open(fmt.Sprintf("assets/%s.png", icon))
@@ -101,7 +150,8 @@ func NewUploadView(window fyne.Window) (uv *UploadView) {
 		}
 	}
 
-	for i, icon := range keyIconNames {
+	for i, button := range controller.SNESButtons {
+		icon := keyIconNames[button]
 		resource, err := assets.Open(fmt.Sprintf("assets/%s.svg.png", icon))
 		if err != nil {
 			panic(fmt.Sprintf("Error opening asset: %v", err))
@@ -165,6 +215,7 @@ func NewUploadView(window fyne.Window) (uv *UploadView) {
 	uploadButton.Disable()
 	defer func() {
 		uv.UploadButton.OnTapped = handleUpload(uv)
+		go uv.watchDevices()
 	}()
 	window.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyU, Modifier: fyne.KeyModifierAlt}, func(shortcut fyne.Shortcut) {
 		handleUpload(uv)()
@@ -178,15 +229,62 @@ func NewUploadView(window fyne.Window) (uv *UploadView) {
 		printCheatSheet(uv)
 	})
 
+	openProfileButton := widget.NewButton("Open Profile", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			uv.OpenProfile(reader)
+		}, window)
+	})
+	openProfileButton.Disable()
+
+	saveProfileButton := widget.NewButton("Save Profile", func() {
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			defer writer.Close()
+
+			uv.SaveProfile(writer)
+		}, window)
+	})
+	saveProfileButton.Disable()
+
+	deviceSelect := widget.NewSelect(nil, func(name string) {
+		if name != "" {
+			uv.selectDevice(name)
+		}
+	})
+	deviceSelect.PlaceHolder = "No adapter connected"
+
+	disconnectButton := widget.NewButton("Disconnect", func() {
+		if _, port := uv.current(); port != "" {
+			uv.closeDevice(port)
+		}
+	})
+	disconnectButton.Disable()
+
 	versionLabel := widget.NewLabel("")
 
 	return &UploadView{
+		window:                window,
+		Devices:               controller.NewManager(controller.ControllerOptions{}),
+		DeviceSelect:          deviceSelect,
+		DisconnectButton:      disconnectButton,
+		traces:                map[string]fyne.URIWriteCloser{},
 		ConnectModal:          connectModal,
+		SettingsModal:         settingsModal,
+		FlashWizard:           flashWizard,
 		GamepadMapView:        gamepad,
 		SelectLayerModal:      selectLayerModal,
 		ClearMapButton:        clearMapButton,
 		UploadButton:          uploadButton,
 		PrintCheatSheetButton: printCheatSheetButton,
+		OpenProfileButton:     openProfileButton,
+		SaveProfileButton:     saveProfileButton,
 		VersionLabel:          versionLabel,
 	}
 }
@@ -222,12 +320,15 @@ func (uv *UploadView) Draw(window fyne.Window) {
 	window.SetContent(
 		container.NewHBox(
 			container.NewVBox(
-				uv.ConnectModal.Button,
+				container.NewBorder(nil, nil, nil, container.NewHBox(uv.FlashWizard.Button, uv.SettingsModal.Button), uv.ConnectModal.Button),
+				container.NewBorder(nil, nil, nil, uv.DisconnectButton, uv.DeviceSelect),
 				layout.NewSpacer(),
 				uv.GamepadMapView.Container,
+				uv.GamepadMapView.Warnings,
 				layout.NewSpacer(),
 				bottomButtonsGrid,
 				uv.PrintCheatSheetButton,
+				container.New(layout.NewGridLayout(2), uv.OpenProfileButton, uv.SaveProfileButton),
 				container.NewHBox(
 					layout.NewSpacer(),
 					uv.VersionLabel,
@@ -239,6 +340,7 @@ func (uv *UploadView) Draw(window fyne.Window) {
 
 func (uv *UploadView) EnableUpload() {
 	uv.UploadButton.Enable()
+	uv.OpenProfileButton.Enable()
 }
 
 func (uv *UploadView) Reset() {
@@ -253,11 +355,19 @@ func (uv *UploadView) Reset() {
 	uv.ConnectModal.Button.SetText("Connect")
 
 	uv.PrintCheatSheetButton.Disable()
+	uv.OpenProfileButton.Disable()
+	uv.SaveProfileButton.Disable()
 }
 
-func (uv *UploadView) Upload() {
+// Upload uploads the selected map and reports whether it succeeded.
+func (uv *UploadView) Upload() bool {
+	c, _ := uv.current()
+	if c == nil {
+		return false
+	}
+
 	uv.GamepadMapView.InfoOverlay(fmt.Sprintf("Uploading map %d", uv.GamepadMapView.SelectedGamepadMap()+1))
-	err := uv.Controller.Upload(uint8(uv.GamepadMapView.SelectedGamepadMap()), uv.GamepadMapView.Map())
+	err := c.UploadVerified(uint8(uv.GamepadMapView.SelectedGamepadMap()), uv.GamepadMapView.Map())
 	if err != nil {
 		uv.GamepadMapView.ErrorOverlay(fmt.Sprintf("Error uploading gamepad map %d: %v", uv.GamepadMapView.SelectedGamepadMap()+1, err))
 
@@ -265,7 +375,7 @@ func (uv *UploadView) Upload() {
 			<-time.After(2 * time.Second)
 			uv.Reset()
 		}()
-		return
+		return false
 	}
 
 	uv.GamepadMapView.InfoOverlay(fmt.Sprintf("Map %d uploaded", uv.GamepadMapView.SelectedGamepadMap()+1))
@@ -273,10 +383,97 @@ func (uv *UploadView) Upload() {
 		<-time.After(1 * time.Second)
 		uv.GamepadMapView.HideOverlay()
 	}()
+
+	return true
+}
+
+// OpenProfile applies the profile read from reader to the adapter, asking
+// first if lint finds errors in its maps.
+func (uv *UploadView) OpenProfile(reader fyne.URIReadCloser) {
+	p, err := profile.Decode(reader, profile.FormatOf(reader.URI().Name()))
+	if err != nil {
+		dialog.ShowError(err, uv.window)
+		return
+	}
+
+	apply := func() {
+		c, _ := uv.current()
+		if c == nil {
+			return
+		}
+
+		uv.GamepadMapView.InfoOverlay(fmt.Sprintf("Applying profile %s...", p.Name))
+		if _, err := c.ApplyAll(p.GamepadMaps()); err != nil {
+			uv.GamepadMapView.ErrorOverlay(fmt.Sprintf("Error applying profile: %v", err))
+
+			go func() {
+				<-time.After(2 * time.Second)
+				uv.Reset()
+			}()
+			return
+		}
+		uv.profile = p
+
+		uv.Download()
+		uv.GamepadMapView.SelectGamepadMap(uv.GamepadMapView.SelectedGamepadMap())
+
+		uv.GamepadMapView.InfoOverlay(fmt.Sprintf("Profile %s applied", p.Name))
+		go func() {
+			<-time.After(1 * time.Second)
+			uv.GamepadMapView.HideOverlay()
+		}()
+	}
+
+	findings := lint.Maps(p.GamepadMaps())
+	if lint.Max(findings) < lint.Error {
+		apply()
+		return
+	}
+
+	var problems []string
+	for _, f := range findings {
+		if f.Severity >= lint.Error {
+			problems = append(problems, f.String())
+		}
+	}
+
+	dialog.ShowConfirm("Open profile", fmt.Sprintf("The profile has errors:\n%s\n\nApply it anyway?", strings.Join(problems, "\n")), func(ok bool) {
+		if ok {
+			apply()
+		}
+	}, uv.window)
+}
+
+// SaveProfile writes the maps of the adapter to writer, with the description
+// of the profile opened last, if any.
+func (uv *UploadView) SaveProfile(writer fyne.URIWriteCloser) {
+	name := strings.TrimSuffix(writer.URI().Name(), writer.URI().Extension())
+
+	p := profile.New(name, uv.GamepadMapView.GamepadMaps)
+	if uv.profile != nil {
+		p.Name = uv.profile.Name
+		p.Author = uv.profile.Author
+		p.Notes = uv.profile.Notes
+		for i := range p.Maps {
+			if i < len(uv.profile.Maps) {
+				p.Maps[i].Title = uv.profile.Maps[i].Title
+				p.Maps[i].Description = uv.profile.Maps[i].Description
+			}
+		}
+	}
+
+	if err := profile.Encode(writer, p, profile.FormatOf(writer.URI().Name())); err != nil {
+		dialog.ShowError(fmt.Errorf("failed to save profile: %w", err), uv.window)
+	}
 }
 
 func (uv *UploadView) Download() {
-	gamepadMaps, err := uv.Controller.Download()
+	c, _ := uv.current()
+	if c == nil {
+		return
+	}
+
+	gamepadMaps, err := c.Download()
 	if err != nil {
 		uv.GamepadMapView.ErrorOverlay(fmt.Sprintf("Error downloading gamepad maps: %v", err))
 
@@ -289,25 +486,22 @@ func (uv *UploadView) Download() {
 
 	uv.GamepadMapView.SetGamepadMaps(gamepadMaps)
 
+	states := controller.SlotStates(gamepadMaps)
+
 	maps := uv.SelectLayerModal.Maps
 	for i := range maps {
-		maps[i].Empty = uv.GamepadMapView.IsEmpty(i)
+		if i < len(states) {
+			maps[i].State = states[i]
+		}
 	}
 	uv.SelectLayerModal.SetMaps(maps)
 }
 
-func handleConnect(uv *UploadView, c *controller.Controller, port string) func() {
+func handleConnect(uv *UploadView, port string) func() {
 	return func() {
-		var err error
-
 		uv.GamepadMapView.InfoOverlay(fmt.Sprintf("Connecting to %s...", port))
 
-		if c != nil {
-			c.Close()
-		}
-
-		c, err := controller.NewController(port)
-		if err != nil {
+		if err := uv.openDevice(port); err != nil {
 			uv.GamepadMapView.Disable()
 			uv.GamepadMapView.ErrorOverlay(fmt.Sprintf("Error connecting to controller: %v", err))
 
@@ -317,45 +511,361 @@ func handleConnect(uv *UploadView, c *controller.Controller, port string) func()
 			}()
 			return
 		}
-		uv.Controller = c
 
-		uv.GamepadMapView.InfoOverlay("Downloading gamepad maps...")
-		uv.Download()
+		uv.selectDevice(port)
+	}
+}
 
-		uv.GamepadMapView.SelectGamepadMap(uv.GamepadMapView.SelectedGamepadMap())
-		uv.GamepadMapView.Enable()
-		uv.GamepadMapView.HideOverlay()
+// openDevice connects to port as a session of Devices, replacing the open
+// session of the port, if any.
+func (uv *UploadView) openDevice(port string) error {
+	if _, ok := uv.Devices.Get(port); ok {
+		uv.Devices.Close(port)
+	}
+	uv.closeTrace(port)
+
+	timeouts := uv.SettingsModal.Timeouts()
+
+	opts := uv.connectOptions()
+	opts.OnStateChange = func(state controller.ConnectionState) {
+		if _, shown := uv.current(); port == shown {
+			uv.handleStateChange(state)
+		}
+	}
+	if uv.SettingsModal.Reconnect() {
+		policy := controller.DefaultReconnectPolicy
+		opts.Reconnect = &policy
+	}
+	if uv.SettingsModal.RecordSession() {
+		trace, err := fyne.CurrentApp().Storage().Create(fmt.Sprintf("session-%s.jsonl", time.Now().Format("20060102-150405.000")))
+		if err != nil {
+			return fmt.Errorf("failed to create session recording: %w", err)
+		}
+		uv.mu.Lock()
+		uv.traces[port] = trace
+		uv.mu.Unlock()
+		opts.Trace = trace
+	}
 
-		uv.SelectLayerModal.Button.Enable()
-		uv.SelectLayerModal.Modal.Show()
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeouts.Connect > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeouts.Connect)
+	}
+	_, err := uv.Devices.OpenWithOptions(ctx, port, port, opts)
+	cancel()
+	if err != nil {
+		uv.closeTrace(port)
+		return err
+	}
+
+	uv.refreshDevices()
 
-		uv.ClearMapButton.Enable()
+	return nil
+}
+
+// refreshDevices lists the open sessions in the device switcher.
+func (uv *UploadView) refreshDevices() {
+	var names []string
+	for _, s := range uv.Devices.Sessions() {
+		names = append(names, s.Name)
+	}
 
+	uv.DeviceSelect.Options = names
+	uv.DeviceSelect.Refresh()
+
+	if len(names) > 0 {
+		uv.DisconnectButton.Enable()
+	} else {
+		uv.DisconnectButton.Disable()
+	}
+}
+
+// selectDevice shows the adapter of session name and downloads its maps.
+func (uv *UploadView) selectDevice(name string) {
+	s, ok := uv.Devices.Get(name)
+	if !ok {
+		return
+	}
+
+	uv.show(s.Controller, name)
+	uv.FlashWizard.Button.Enable()
+
+	// not SetSelected, which would call selectDevice again
+	uv.DeviceSelect.Selected = name
+	uv.DeviceSelect.Refresh()
+
+	firmwareInfo, err := s.Controller.FirmwareInfo()
+	if err != nil {
+		uv.GamepadMapView.ErrorOverlay(fmt.Sprintf("Error getting firmware version: %v", err))
+
+		go func() {
+			<-time.After(2 * time.Second)
+			uv.Reset()
+		}()
+
+		return
+	}
+
+	uv.firmwareInfo = firmwareInfo
+
+	uv.mu.Lock()
+	trace := uv.traces[name]
+	uv.mu.Unlock()
+	if trace != nil {
+		uv.VersionLabel.SetText(fmt.Sprintf("%s\nRecording to %s", firmwareInfo, trace.URI().Path()))
+	} else {
+		uv.VersionLabel.SetText(firmwareInfo.String())
+	}
+
+	if err := firmwareInfo.Require(controller.FeatureDownload); err != nil {
+		uv.GamepadMapView.ErrorOverlay(fmt.Sprintf("Unsupported adapter: %v", err))
+
+		go func() {
+			<-time.After(2 * time.Second)
+			uv.Reset()
+		}()
+
+		return
+	}
+
+	uv.GamepadMapView.InfoOverlay("Downloading gamepad maps...")
+	uv.Download()
+
+	uv.GamepadMapView.SelectGamepadMap(uv.GamepadMapView.SelectedGamepadMap())
+	uv.GamepadMapView.Enable()
+	uv.GamepadMapView.HideOverlay()
+
+	uv.SelectLayerModal.Button.Enable()
+	uv.SelectLayerModal.Modal.Show()
+
+	uv.ClearMapButton.Enable()
+
+	if firmwareInfo.Supports(controller.FeatureUpload) {
 		uv.EnableUpload()
+	} else {
+		uv.UploadButton.Disable()
+		uv.OpenProfileButton.Disable()
+	}
 
-		uv.PrintCheatSheetButton.Enable()
+	uv.PrintCheatSheetButton.Enable()
+	uv.SaveProfileButton.Enable()
 
-		uv.ConnectModal.Button.SetText(fmt.Sprintf("Connected to %s", port))
+	uv.ConnectModal.Button.SetText(fmt.Sprintf("Connected to %s", name))
+}
 
-		firmwareVersion, err := uv.Controller.GetFirmwareVersion()
-		if err != nil {
-			uv.GamepadMapView.ErrorOverlay(fmt.Sprintf("Error getting firmware version: %v", err))
+// closeDevice closes the session of port. If it is shown, the view switches
+// to the next open session.
+func (uv *UploadView) closeDevice(port string) {
+	uv.Devices.Close(port)
+	uv.closeTrace(port)
+	uv.refreshDevices()
 
-			go func() {
-				<-time.After(2 * time.Second)
-				uv.Reset()
-			}()
+	if !uv.hide(port) {
+		return
+	}
+
+	uv.DeviceSelect.ClearSelected()
+
+	uv.Reset()
+	uv.VersionLabel.SetText("")
+
+	if sessions := uv.Devices.Sessions(); len(sessions) > 0 {
+		uv.selectDevice(sessions[0].Name)
+	}
+}
+
+// connectOptions returns the options of connections from the settings.
+func (uv *UploadView) connectOptions() controller.ControllerOptions {
+	timeouts := uv.SettingsModal.Timeouts()
+	serial := uv.SettingsModal.SerialSettings()
+
+	return controller.ControllerOptions{
+		Timeouts: &timeouts,
+		Serial:   &serial,
+		Reset:    uv.SettingsModal.ResetMode(),
+	}
+}
+
+// flashFirmware updates the firmware of the adapter connected last and
+// connects to the new firmware.
+func (uv *UploadView) flashFirmware(img *flasher.Image, opts components.FlashOptions, progress func(flasher.Progress)) (controller.FirmwareInfo, error) {
+	uv.deviceMu.Lock()
+	target := uv.lastPort
+	uv.deviceMu.Unlock()
+	if target == "" {
+		return controller.FirmwareInfo{}, fmt.Errorf("connect to the adapter first")
+	}
+
+	uv.Devices.Close(target)
+	uv.closeTrace(target)
+	uv.refreshDevices()
+	uv.hide(target)
+
+	uv.Reset()
+	uv.VersionLabel.SetText("")
+	uv.GamepadMapView.InfoOverlay("Updating firmware...")
+
+	info, err := flasher.Update(context.Background(), target, img, flasher.Options{
+		SkipBackup: !opts.Backup,
+		SkipVerify: !opts.Verify,
+		Controller: uv.connectOptions(),
+		OnProgress: progress,
+	})
+
+	handleConnect(uv, target)()
+
+	return info, err
+}
+
+func (uv *UploadView) closeTrace(port string) {
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+
+	if trace := uv.traces[port]; trace != nil {
+		trace.Close()
+		delete(uv.traces, port)
+	}
+}
+
+func (uv *UploadView) handleStateChange(state controller.ConnectionState) {
+	switch state {
+	case controller.StateReconnecting:
+		uv.GamepadMapView.InfoOverlay("Connection lost, reconnecting...")
+	case controller.StateConnected:
+		uv.GamepadMapView.HideOverlay()
+	}
+}
+
+// current returns the controller and port of the shown adapter, nil and ""
+// if none is shown.
+func (uv *UploadView) current() (*controller.Controller, string) {
+	uv.deviceMu.Lock()
+	defer uv.deviceMu.Unlock()
+
+	return uv.Controller, uv.port
+}
+
+// show makes c, connected to port, the shown adapter.
+func (uv *UploadView) show(c *controller.Controller, port string) {
+	uv.deviceMu.Lock()
+	defer uv.deviceMu.Unlock()
+
+	uv.Controller = c
+	uv.port = port
+	uv.lastPort = port
+}
+
+// hide stops showing the adapter at port and reports whether it was shown.
+func (uv *UploadView) hide(port string) bool {
+	uv.deviceMu.Lock()
+	defer uv.deviceMu.Unlock()
+
+	if port == "" || port != uv.port {
+		return false
+	}
+	uv.Controller = nil
+	uv.port = ""
+
+	return true
+}
 
+// hotplug closes the sessions of adapters that are unplugged and reconnects
+// them once they are plugged in again. Adapters that were not connected when
+// they were unplugged are left alone.
+type hotplug struct {
+	// connected reports whether a session of port is open.
+	connected func(port string) bool
+	// detach closes the session of the unplugged port.
+	detach func(port string)
+	// attach reconnects to the port plugged in again.
+	attach func(port string)
+
+	unplugged map[string]bool
+}
+
+func (h *hotplug) handle(e controller.DeviceEvent) {
+	name := e.Port.Name
+
+	switch e.Type {
+	case controller.Detached:
+		if !h.connected(name) {
 			return
 		}
+		if h.unplugged == nil {
+			h.unplugged = map[string]bool{}
+		}
+		h.unplugged[name] = true
+
+		h.detach(name)
+	case controller.Attached:
+		if !h.unplugged[name] {
+			return
+		}
+		delete(h.unplugged, name)
+
+		h.attach(name)
+	}
+}
 
-		uv.VersionLabel.SetText(strings.ReplaceAll(firmwareVersion, "\n", " "))
+// watchDevices closes the sessions of unplugged adapters and reconnects them
+// once they are plugged in again.
+func (uv *UploadView) watchDevices() {
+	w := controller.NewWatcher(controller.WatcherOptions{
+		Filter: func(controller.PortInfo) bool { return true },
+	})
+
+	h := hotplug{
+		connected: func(port string) bool {
+			_, ok := uv.Devices.Get(port)
+			return ok
+		},
+		detach: func(port string) {
+			_, shown := uv.current()
+			uv.closeDevice(port)
+			if _, now := uv.current(); port == shown && now == "" {
+				uv.GamepadMapView.InfoOverlay(fmt.Sprintf("%s unplugged, waiting for it to return...", port))
+			}
+		},
+		attach: func(port string) {
+			if _, shown := uv.current(); shown == "" {
+				handleConnect(uv, port)()
+			} else if err := uv.openDevice(port); err != nil {
+				log.Printf("failed to reconnect %s: %v", port, err)
+			}
+		},
+	}
+
+	for e := range w.Events() {
+		h.handle(e)
 	}
 }
 
 func handleUpload(uv *UploadView) func() {
 	return func() {
-		uv.Upload()
-		uv.Download()
+		// the shortcut also fires while the button is disabled
+		if uv.UploadButton.Disabled() {
+			return
+		}
+
+		findings := uv.GamepadMapView.Findings()
+		if lint.Max(findings) < lint.Error {
+			if uv.Upload() {
+				uv.Download()
+			}
+			return
+		}
+
+		var problems []string
+		for _, f := range findings {
+			if f.Severity >= lint.Error {
+				problems = append(problems, f.Message)
+			}
+		}
+
+		dialog.ShowConfirm("Upload map", fmt.Sprintf("The map has errors:\n%s\n\nUpload it anyway?", strings.Join(problems, "\n")), func(ok bool) {
+			if ok && uv.Upload() {
+				uv.Download()
+			}
+		}, uv.window)
 	}
 }
@@ -0,0 +1,91 @@
+package views
+
+import (
+	"reflect"
+	"testing"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func TestHotplug(t *testing.T) {
+	open := map[string]bool{"/dev/ttyUSB0": true, "/dev/ttyUSB1": true}
+	var calls []string
+
+	h := hotplug{
+		connected: func(port string) bool { return open[port] },
+		detach: func(port string) {
+			calls = append(calls, "detach "+port)
+			delete(open, port)
+		},
+		attach: func(port string) {
+			calls = append(calls, "attach "+port)
+			open[port] = true
+		},
+	}
+
+	event := func(typ controller.DeviceEventType, port string) controller.DeviceEvent {
+		return controller.DeviceEvent{Type: typ, Port: controller.PortInfo{Name: port}}
+	}
+	for _, e := range []controller.DeviceEvent{
+		// present at start, already connected or never connected
+		event(controller.Attached, "/dev/ttyUSB0"),
+		event(controller.Attached, "/dev/ttyACM0"),
+		// a connected adapter is unplugged and returns
+		event(controller.Detached, "/dev/ttyUSB0"),
+		event(controller.Attached, "/dev/ttyUSB0"),
+		// an adapter that was not connected comes and goes
+		event(controller.Detached, "/dev/ttyACM0"),
+		event(controller.Attached, "/dev/ttyACM0"),
+		// a second adapter is unplugged and returns after being unplugged
+		// a second time while it was away
+		event(controller.Detached, "/dev/ttyUSB1"),
+		event(controller.Detached, "/dev/ttyUSB1"),
+		event(controller.Attached, "/dev/ttyUSB1"),
+		event(controller.Attached, "/dev/ttyUSB1"),
+	} {
+		h.handle(e)
+	}
+
+	want := []string{
+		"detach /dev/ttyUSB0",
+		"attach /dev/ttyUSB0",
+		"detach /dev/ttyUSB1",
+		"attach /dev/ttyUSB1",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got %q, want %q", calls, want)
+	}
+}
+
+func TestUploadWithoutAdapter(t *testing.T) {
+	uv := &UploadView{}
+
+	// the adapter was unplugged before the upload started
+	if uv.Upload() {
+		t.Error("upload without an adapter succeeded")
+	}
+	uv.Download()
+}
+
+func TestShowHide(t *testing.T) {
+	uv := &UploadView{}
+	c := &controller.Controller{}
+
+	uv.show(c, "/dev/ttyUSB0")
+	if uv.hide("/dev/ttyUSB1") {
+		t.Error("hid a port that is not shown")
+	}
+	if got, port := uv.current(); got != c || port != "/dev/ttyUSB0" {
+		t.Errorf("got %p at %q, want %p at /dev/ttyUSB0", got, port, c)
+	}
+
+	if !uv.hide("/dev/ttyUSB0") {
+		t.Error("failed to hide the shown port")
+	}
+	if got, port := uv.current(); got != nil || port != "" {
+		t.Errorf("got %p at %q after hiding", got, port)
+	}
+	if uv.lastPort != "/dev/ttyUSB0" {
+		t.Errorf("got last port %q, want /dev/ttyUSB0", uv.lastPort)
+	}
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+)
+
+// ApplyError is returned by ApplyAll when a slot could not be updated. If
+// RollbackErr is nil, all slots hold their previous maps again.
+type ApplyError struct {
+	Slot        int
+	Err         error
+	RollbackErr error
+}
+
+func (e *ApplyError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("failed to apply map %d: %v; failed to restore previous maps, the adapter may hold a mix of old and new maps: %v", e.Slot, e.Err, e.RollbackErr)
+	}
+
+	return fmt.Sprintf("failed to apply map %d: %v; previous maps restored", e.Slot, e.Err)
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyAll makes the adapter hold exactly maps. Only slots that differ are
+// uploaded and verified; if one fails, the slots changed so far are restored.
+// It returns the changed slots.
+func (c *Controller) ApplyAll(maps []GamepadMap) ([]int, error) {
+	return c.ApplyAllContext(context.Background(), maps)
+}
+
+func (c *Controller) ApplyAllContext(ctx context.Context, maps []GamepadMap) ([]int, error) {
+	v, err := c.submit(ctx, func(ctx context.Context) (interface{}, error) {
+		return c.applyAll(ctx, maps)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]int), nil
+}
+
+func (c *Controller) applyAll(ctx context.Context, maps []GamepadMap) ([]int, error) {
+	snapshot, err := c.download(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current maps: %w", err)
+	}
+
+	if len(maps) != len(snapshot) {
+		return nil, fmt.Errorf("got %d maps, the adapter has %d", len(maps), len(snapshot))
+	}
+
+	var changed []int
+	for i := range maps {
+		if maps[i] == snapshot[i] {
+			continue
+		}
+
+		// the slot may be partially written even if the upload fails
+		changed = append(changed, i)
+
+		if err := c.uploadVerified(ctx, uint8(i), maps[i], DefaultUploadRetries); err != nil {
+			return nil, &ApplyError{
+				Slot:        i,
+				Err:         err,
+				RollbackErr: c.restore(snapshot, changed),
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+// restore uploads the snapshot of the given slots. It does not use the
+// context of the failed operation, which may be the reason for the failure.
+func (c *Controller) restore(snapshot []GamepadMap, slots []int) error {
+	var (
+		failed   []int
+		firstErr error
+	)
+
+	for _, i := range slots {
+		if err := c.uploadVerified(context.Background(), uint8(i), snapshot[i], DefaultUploadRetries); err != nil {
+			failed = append(failed, i)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if firstErr != nil {
+		return fmt.Errorf("failed to restore maps %v: %w", failed, firstErr)
+	}
+
+	return nil
+}
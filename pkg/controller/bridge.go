@@ -0,0 +1,391 @@
+package controller
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// BridgeMode is the protocol ServeBridge speaks to its clients.
+type BridgeMode string
+
+const (
+	// BridgeRaw passes the bytes through unchanged, for tcp:// targets.
+	BridgeRaw BridgeMode = "raw"
+	// BridgeRFC2217 speaks telnet with the com port option, for rfc2217://
+	// targets, so clients can change the serial settings.
+	BridgeRFC2217 BridgeMode = "rfc2217"
+)
+
+// ParseBridgeMode parses "raw" or "rfc2217".
+func ParseBridgeMode(s string) (BridgeMode, error) {
+	switch m := BridgeMode(s); m {
+	case BridgeRaw, BridgeRFC2217:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid bridge mode %q", s)
+	}
+}
+
+// RFC2217NegotiationWindow is the time ServeBridge waits for the serial
+// settings of an RFC 2217 client before it opens the port. Opening resets the
+// adapter, so the DTR state has to be known by then.
+const RFC2217NegotiationWindow = 250 * time.Millisecond
+
+type BridgeOptions struct {
+	// Target is the port to share, usually a serial port.
+	Target string
+	Mode   BridgeMode
+	// Serial are the settings the port is opened with. RFC 2217 clients can
+	// override them.
+	Serial SerialSettings
+	// Reset ResetNone holds DTR low when the port is opened, so clients
+	// connecting do not reset the adapter.
+	Reset ResetMode
+
+	// Logf, if set, receives the connection events.
+	Logf func(format string, args ...interface{})
+}
+
+func (opts BridgeOptions) logf(format string, args ...interface{}) {
+	if opts.Logf != nil {
+		opts.Logf(format, args...)
+	}
+}
+
+// ServeBridge shares opts.Target with the clients accepted from ln until ctx
+// ends. The port is opened for every client, which resets the adapter like a
+// local connection does, and only one client is served at a time.
+func ServeBridge(ctx context.Context, ln net.Listener, opts BridgeOptions) error {
+	if opts.Mode == "" {
+		opts.Mode = BridgeRaw
+	}
+	opts.Serial = *ControllerOptions{Serial: &opts.Serial, Reset: opts.Reset}.serialSettings()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ln.Close()
+		case <-done:
+		}
+	}()
+
+	busy := make(chan struct{}, 1)
+
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		select {
+		case busy <- struct{}{}:
+		default:
+			opts.logf("%s: refused, %s is in use", nc.RemoteAddr(), opts.Target)
+			nc.Close()
+			continue
+		}
+
+		go func() {
+			defer func() { <-busy }()
+
+			opts.logf("%s: connected", nc.RemoteAddr())
+			if err := serveBridgeConn(ctx, nc, opts); err != nil {
+				opts.logf("%s: %v", nc.RemoteAddr(), err)
+			}
+			opts.logf("%s: disconnected", nc.RemoteAddr())
+		}()
+	}
+}
+
+func serveBridgeConn(ctx context.Context, nc net.Conn, opts BridgeOptions) error {
+	defer nc.Close()
+
+	b := &bridgeConn{
+		nc:       nc,
+		settings: opts.Serial,
+		logf:     opts.logf,
+	}
+
+	// data the client sent while negotiating, for the port once it is open
+	var pending []byte
+
+	if opts.Mode == BridgeRFC2217 {
+		b.dec = &telnetDecoder{
+			onCommand: b.handleCommand,
+			onSub:     b.handleSub,
+		}
+
+		if err := nc.SetReadDeadline(time.Now().Add(RFC2217NegotiationWindow)); err != nil {
+			return err
+		}
+
+		buf := make([]byte, 256)
+		for {
+			n, err := nc.Read(buf)
+			pending = append(pending, b.dec.decode(buf[:n])...)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			if err != nil {
+				return ignoreClosed(err)
+			}
+		}
+
+		if err := nc.SetReadDeadline(time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	port, err := openTransport(ctx, opts.Target, &b.settings)
+	if err != nil {
+		return err
+	}
+	defer port.Close()
+
+	b.mu.Lock()
+	b.port = port
+	b.mu.Unlock()
+
+	if len(pending) > 0 {
+		if _, err := port.Write(pending); err != nil {
+			return ignoreClosed(err)
+		}
+	}
+
+	errc := make(chan error, 2)
+
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := port.Read(buf)
+			if n == 0 && err == nil {
+				// blocking serial reads return nothing once the device is gone
+				err = io.EOF
+			}
+			if n > 0 {
+				if werr := b.write(buf[:n]); werr != nil {
+					errc <- werr
+					return
+				}
+			}
+			if err != nil {
+				errc <- fmt.Errorf("failed to read from %s: %w", opts.Target, err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := nc.Read(buf)
+			data := buf[:n]
+			if b.dec != nil {
+				data = b.dec.decode(data)
+			}
+			if len(data) > 0 {
+				if _, werr := port.Write(data); werr != nil {
+					errc <- fmt.Errorf("failed to write to %s: %w", opts.Target, werr)
+					return
+				}
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	// closing both ends by the deferred calls stops the other direction
+	return ignoreClosed(<-errc)
+}
+
+// bridgeConn is a client connection of ServeBridge.
+type bridgeConn struct {
+	nc  net.Conn
+	dec *telnetDecoder
+
+	writeMu sync.Mutex
+	// acked are the telnet options confirmed to the client already
+	acked map[[2]byte]bool
+
+	mu       sync.Mutex
+	port     io.ReadWriteCloser
+	settings SerialSettings
+
+	logf func(format string, args ...interface{})
+}
+
+// write sends data from the port to the client.
+func (b *bridgeConn) write(data []byte) error {
+	if b.dec != nil {
+		data = escapeIAC(data)
+	}
+
+	return b.writeRaw(data)
+}
+
+func (b *bridgeConn) writeRaw(data []byte) error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	_, err := b.nc.Write(data)
+
+	return err
+}
+
+// handleCommand accepts binary mode and the com port option and refuses the
+// other options. Every answer is sent once, so that the negotiation ends.
+func (b *bridgeConn) handleCommand(cmd, option byte) {
+	var reply byte
+	switch {
+	case cmd == telnetWILL && (option == telnetBinary || option == telnetComPort):
+		reply = telnetDO
+	case cmd == telnetDO && option == telnetBinary:
+		reply = telnetWILL
+	case cmd == telnetWILL:
+		reply = telnetDONT
+	case cmd == telnetDO:
+		reply = telnetWONT
+	default:
+		return
+	}
+
+	if b.acked == nil {
+		b.acked = map[[2]byte]bool{}
+	}
+	if b.acked[[2]byte{reply, option}] {
+		return
+	}
+	b.acked[[2]byte{reply, option}] = true
+
+	_ = b.writeRaw([]byte{telnetIAC, reply, option})
+}
+
+// handleSub applies a com port command and answers with the resulting value.
+func (b *bridgeConn) handleSub(sub []byte) {
+	if len(sub) < 2 || sub[0] != telnetComPort {
+		return
+	}
+	cmd, value := sub[1], sub[2:]
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &b.settings
+	reply := value
+
+	switch cmd {
+	case comSetBaudRate:
+		if len(value) != 4 {
+			return
+		}
+		if rate := binary.BigEndian.Uint32(value); rate != 0 {
+			s.BaudRate = int(rate)
+			b.applyMode()
+		}
+		reply = binary.BigEndian.AppendUint32(nil, uint32(s.withDefaults().BaudRate))
+	case comSetDataSize:
+		if len(value) != 1 {
+			return
+		}
+		if value[0] != 0 {
+			s.DataBits = int(value[0])
+			b.applyMode()
+		}
+		reply = []byte{byte(s.withDefaults().DataBits)}
+	case comSetParity:
+		if len(value) != 1 {
+			return
+		}
+		for p, v := range comParities {
+			if v == value[0] {
+				s.Parity = p
+				b.applyMode()
+			}
+		}
+		reply = []byte{comParities[s.withDefaults().Parity]}
+	case comSetStopSize:
+		if len(value) != 1 {
+			return
+		}
+		for sb, v := range comStopBits {
+			if v == value[0] {
+				s.StopBits = sb
+				b.applyMode()
+			}
+		}
+		reply = []byte{comStopBits[s.withDefaults().StopBits]}
+	case comSetControl:
+		if len(value) != 1 {
+			return
+		}
+		switch value[0] {
+		case comDTROn, comDTROff:
+			s.DTR = LineOff
+			if value[0] == comDTROn {
+				s.DTR = LineOn
+			}
+			b.applyLine(func(p serial.Port) error { return p.SetDTR(s.DTR == LineOn) })
+		case comRTSOn, comRTSOff:
+			s.RTS = LineOff
+			if value[0] == comRTSOn {
+				s.RTS = LineOn
+			}
+			b.applyLine(func(p serial.Port) error { return p.SetRTS(s.RTS == LineOn) })
+		}
+	}
+
+	_ = b.writeRaw(comPortSub(cmd+comServerOffset, reply))
+}
+
+// applyMode changes the line settings of an open serial port. Other ports
+// only take the settings when they are opened.
+func (b *bridgeConn) applyMode() {
+	p, ok := b.port.(serial.Port)
+	if !ok {
+		return
+	}
+
+	mode, err := b.settings.mode()
+	if err == nil {
+		err = p.SetMode(mode)
+	}
+	if err != nil {
+		b.logf("%s: failed to change serial settings: %v", b.nc.RemoteAddr(), err)
+	}
+}
+
+func (b *bridgeConn) applyLine(set func(serial.Port) error) {
+	p, ok := b.port.(serial.Port)
+	if !ok {
+		return
+	}
+
+	if err := set(p); err != nil {
+		b.logf("%s: failed to change modem lines: %v", b.nc.RemoteAddr(), err)
+	}
+}
+
+// ignoreClosed hides the errors of a connection closed by either end.
+func ignoreClosed(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,75 @@
+package controller_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/emulator"
+)
+
+func TestBridgeLoopback(t *testing.T) {
+	for _, tt := range []struct {
+		mode   controller.BridgeMode
+		scheme string
+	}{
+		{controller.BridgeRaw, controller.SchemeTCP},
+		{controller.BridgeRFC2217, controller.SchemeRFC2217},
+	} {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			e, err := emulator.New(emulator.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := "bridge-" + string(tt.mode)
+			e.Register(name)
+			defer controller.UnregisterMemDevice(name)
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			served := make(chan error, 1)
+			go func() {
+				served <- controller.ServeBridge(ctx, ln, controller.BridgeOptions{
+					Target: "mem://" + name,
+					Mode:   tt.mode,
+				})
+			}()
+
+			c, err := controller.OpenWithOptions(ctx, tt.scheme+"://"+ln.Addr().String(), controller.ControllerOptions{})
+			if err != nil {
+				t.Fatalf("failed to connect through the bridge: %v", err)
+			}
+
+			// 0xFF is the telnet IAC byte, which RFC 2217 has to escape
+			want := controller.GamepadMap{0xFF, 0x02, 0x04, 0x08, 0x10, 0xFF, 0x00, 0x00, 0x00, 0xFF}
+			if err := c.UploadVerifiedContext(ctx, 2, want, 0); err != nil {
+				t.Fatalf("failed to upload through the bridge: %v", err)
+			}
+
+			maps, err := c.DownloadContext(ctx)
+			if err != nil {
+				t.Fatalf("failed to download through the bridge: %v", err)
+			}
+			if maps[2] != want {
+				t.Errorf("downloaded %s, want %s", maps[2].Hex(), want.Hex())
+			}
+			if got := e.Maps()[2]; got != want {
+				t.Errorf("emulator holds %s, want %s", got.Hex(), want.Hex())
+			}
+
+			c.Close()
+			cancel()
+			if err := <-served; err != nil {
+				t.Errorf("bridge failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// SNESButton is a button of the SNES gamepad. The buttons are flags, so a
+// value can hold a set of buttons.
+type SNESButton uint16
+
+// The SNES buttons in the order of the bytes of a GamepadMap. Start and
+// Select cannot be mapped.
+const (
+	ButtonUp SNESButton = 1 << iota
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+	ButtonB
+	ButtonA
+	ButtonY
+	ButtonX
+	ButtonL
+	ButtonR
+)
+
+// SNESButtons lists the mappable buttons in map order.
+var SNESButtons = []SNESButton{ButtonUp, ButtonDown, ButtonLeft, ButtonRight, ButtonB, ButtonA, ButtonY, ButtonX, ButtonL, ButtonR}
+
+var snesButtonNames = []string{"Up", "Down", "Left", "Right", "B", "A", "Y", "X", "L", "R"}
+
+// C64Function is a line of the C64 joystick port. A map byte is the set of
+// functions a SNES button triggers.
+type C64Function uint8
+
+const (
+	JoyUp C64Function = 1 << iota
+	JoyDown
+	JoyLeft
+	JoyRight
+	Fire1
+	Fire2
+	Fire3
+	// AutoFire, bit 7, repeats the fire buttons of the same map byte while
+	// the SNES button is held. Without a fire button it has no effect, so a
+	// byte of just AutoFire leaves the button unmapped.
+	AutoFire
+)
+
+// C64Functions lists the functions in bit order.
+var C64Functions = []C64Function{JoyUp, JoyDown, JoyLeft, JoyRight, Fire1, Fire2, Fire3, AutoFire}
+
+var c64FunctionNames = []string{"JoyUp", "JoyDown", "JoyLeft", "JoyRight", "Fire1", "Fire2", "Fire3", "AutoFire"}
+
+// Index returns the position of a single button in a GamepadMap, or -1 for
+// sets of buttons.
+func (b SNESButton) Index() int {
+	if bits.OnesCount16(uint16(b)) != 1 || b > ButtonR {
+		return -1
+	}
+
+	return bits.TrailingZeros16(uint16(b))
+}
+
+// Buttons splits b into single buttons, in map order.
+func (b SNESButton) Buttons() []SNESButton {
+	var buttons []SNESButton
+	for _, button := range SNESButtons {
+		if b&button != 0 {
+			buttons = append(buttons, button)
+		}
+	}
+
+	return buttons
+}
+
+// String names the buttons of b, joined by "|".
+func (b SNESButton) String() string {
+	var names []string
+	for _, button := range b.Buttons() {
+		names = append(names, snesButtonNames[button.Index()])
+	}
+	if rest := b &^ (ButtonR<<1 - 1); rest != 0 {
+		names = append(names, fmt.Sprintf("0x%X", uint16(rest)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "|")
+}
+
+// ParseSNESButton parses button names like "B" or "Up", ignoring case. Sets
+// of buttons are joined by "|" or "+".
+func ParseSNESButton(s string) (SNESButton, error) {
+	var b SNESButton
+
+	for _, name := range splitNames(s) {
+		i := indexFold(snesButtonNames, name)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown SNES button %q", name)
+		}
+		b |= SNESButtons[i]
+	}
+
+	return b, nil
+}
+
+// Functions splits f into single functions, in bit order.
+func (f C64Function) Functions() []C64Function {
+	var functions []C64Function
+	for _, fn := range C64Functions {
+		if f&fn != 0 {
+			functions = append(functions, fn)
+		}
+	}
+
+	return functions
+}
+
+// Effective returns the functions f has an effect on the C64 with, which is
+// f without AutoFire unless f also holds a fire button.
+func (f C64Function) Effective() C64Function {
+	if f&(Fire1|Fire2|Fire3) == 0 {
+		return f &^ AutoFire
+	}
+
+	return f
+}
+
+// String names the functions of f, joined by "|".
+func (f C64Function) String() string {
+	var names []string
+	for i, fn := range C64Functions {
+		if f&fn != 0 {
+			names = append(names, c64FunctionNames[i])
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "|")
+}
+
+// ParseC64Function parses function names like "Fire1" or "JoyUp", ignoring
+// case. Sets of functions are joined by "|" or "+", "none" is no function.
+func ParseC64Function(s string) (C64Function, error) {
+	var f C64Function
+
+	for _, name := range splitNames(s) {
+		if strings.EqualFold(name, "none") {
+			continue
+		}
+
+		i := indexFold(c64FunctionNames, name)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown C64 function %q", name)
+		}
+		f |= C64Functions[i]
+	}
+
+	return f, nil
+}
+
+func splitNames(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '|' || r == '+' || r == ' '
+	})
+}
+
+func indexFold(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Get returns the functions triggered by any of the buttons b.
+func (g GamepadMap) Get(b SNESButton) C64Function {
+	var f C64Function
+	for _, button := range b.Buttons() {
+		f |= C64Function(g[button.Index()])
+	}
+
+	return f
+}
+
+// Set makes the buttons b trigger the functions fns, replacing their previous
+// functions.
+func (g *GamepadMap) Set(b SNESButton, fns ...C64Function) {
+	var f C64Function
+	for _, fn := range fns {
+		f |= fn
+	}
+
+	for _, button := range b.Buttons() {
+		g[button.Index()] = uint8(f)
+	}
+}
+
+// Add makes the buttons b also trigger the functions f.
+func (g *GamepadMap) Add(b SNESButton, f C64Function) {
+	for _, button := range b.Buttons() {
+		g[button.Index()] |= uint8(f)
+	}
+}
+
+// Remove stops the buttons b from triggering the functions f.
+func (g *GamepadMap) Remove(b SNESButton, f C64Function) {
+	for _, button := range b.Buttons() {
+		g[button.Index()] &^= uint8(f)
+	}
+}
+
+// Clear removes all functions from the buttons b.
+func (g *GamepadMap) Clear(b SNESButton) {
+	g.Set(b)
+}
+
+// Functions lists the functions triggered by the buttons b.
+func (g GamepadMap) Functions(b SNESButton) []C64Function {
+	return g.Get(b).Functions()
+}
+
+// ButtonsFor returns the buttons triggering any of the functions f.
+func (g GamepadMap) ButtonsFor(f C64Function) SNESButton {
+	var b SNESButton
+	for _, button := range SNESButtons {
+		if C64Function(g[button.Index()])&f != 0 {
+			b |= button
+		}
+	}
+
+	return b
+}
+
+// Describe lists the functions of the mapped buttons, e.g.
+// "Up=JoyUp B=Fire1|AutoFire", or "none" if no button is mapped.
+func (g GamepadMap) Describe() string {
+	var mapped []string
+	for _, button := range SNESButtons {
+		if f := g.Get(button); f != 0 {
+			mapped = append(mapped, fmt.Sprintf("%s=%s", button, f))
+		}
+	}
+	if len(mapped) == 0 {
+		return "none"
+	}
+
+	return strings.Join(mapped, " ")
+}
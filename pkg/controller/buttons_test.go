@@ -0,0 +1,205 @@
+package controller_test
+
+import (
+	"reflect"
+	"testing"
+
+	"snes2c64gui/pkg/controller"
+)
+
+// TestBitLayout pins the bits the firmware uses: the map byte of a button is
+// at its index and holds the functions as flags.
+func TestBitLayout(t *testing.T) {
+	buttons := []struct {
+		button controller.SNESButton
+		index  int
+		name   string
+	}{
+		{controller.ButtonUp, 0, "Up"},
+		{controller.ButtonDown, 1, "Down"},
+		{controller.ButtonLeft, 2, "Left"},
+		{controller.ButtonRight, 3, "Right"},
+		{controller.ButtonB, 4, "B"},
+		{controller.ButtonA, 5, "A"},
+		{controller.ButtonY, 6, "Y"},
+		{controller.ButtonX, 7, "X"},
+		{controller.ButtonL, 8, "L"},
+		{controller.ButtonR, 9, "R"},
+	}
+	if len(buttons) != len(controller.SNESButtons) || len(buttons) != controller.ButtonCount {
+		t.Fatalf("got %d buttons, want %d", len(controller.SNESButtons), controller.ButtonCount)
+	}
+	for i, b := range buttons {
+		if controller.SNESButtons[i] != b.button {
+			t.Errorf("button %d: got %s, want %s", i, controller.SNESButtons[i], b.name)
+		}
+		if b.button != 1<<b.index {
+			t.Errorf("%s: got bit %#x, want %#x", b.name, uint16(b.button), 1<<b.index)
+		}
+		if got := b.button.Index(); got != b.index {
+			t.Errorf("%s: got index %d, want %d", b.name, got, b.index)
+		}
+	}
+
+	functions := []struct {
+		function controller.C64Function
+		value    uint8
+		name     string
+	}{
+		{controller.JoyUp, 0x01, "JoyUp"},
+		{controller.JoyDown, 0x02, "JoyDown"},
+		{controller.JoyLeft, 0x04, "JoyLeft"},
+		{controller.JoyRight, 0x08, "JoyRight"},
+		{controller.Fire1, 0x10, "Fire1"},
+		{controller.Fire2, 0x20, "Fire2"},
+		{controller.Fire3, 0x40, "Fire3"},
+		{controller.AutoFire, 0x80, "AutoFire"},
+	}
+	if len(functions) != len(controller.C64Functions) {
+		t.Fatalf("got %d functions, want %d", len(controller.C64Functions), len(functions))
+	}
+	for i, f := range functions {
+		if controller.C64Functions[i] != f.function {
+			t.Errorf("function %d: got %s, want %s", i, controller.C64Functions[i], f.name)
+		}
+		if uint8(f.function) != f.value {
+			t.Errorf("%s: got %#02x, want %#02x", f.name, uint8(f.function), f.value)
+		}
+	}
+
+	// a map byte is stored at the index of its button
+	var g controller.GamepadMap
+	g.Set(controller.ButtonY, controller.Fire2, controller.AutoFire)
+	if want := (controller.GamepadMap{6: 0xA0}); g != want {
+		t.Errorf("got %s, want %s", g.Hex(), want.Hex())
+	}
+
+	if got := (controller.ButtonA | controller.ButtonB).Index(); got != -1 {
+		t.Errorf("got index %d for a set of buttons, want -1", got)
+	}
+	if got := (controller.ButtonR << 1).Index(); got != -1 {
+		t.Errorf("got index %d for an unknown button, want -1", got)
+	}
+}
+
+func TestSNESButtonString(t *testing.T) {
+	for _, tt := range []struct {
+		button controller.SNESButton
+		s      string
+	}{
+		{controller.ButtonUp, "Up"},
+		{controller.ButtonR, "R"},
+		{controller.ButtonB | controller.ButtonA, "B|A"},
+		{controller.ButtonR | controller.ButtonUp, "Up|R"},
+		{0, "none"},
+		{controller.ButtonL | controller.ButtonR<<1, "L|0x400"},
+	} {
+		if got := tt.button.String(); got != tt.s {
+			t.Errorf("got %q, want %q", got, tt.s)
+		}
+	}
+}
+
+func TestSNESButtonRoundTrip(t *testing.T) {
+	sets := []controller.SNESButton{controller.ButtonUp | controller.ButtonL, controller.ButtonR<<1 - 1}
+	for _, b := range append(controller.SNESButtons, sets...) {
+		got, err := controller.ParseSNESButton(b.String())
+		if err != nil {
+			t.Errorf("%s: %v", b, err)
+			continue
+		}
+		if got != b {
+			t.Errorf("got %s, want %s", got, b)
+		}
+	}
+
+	got, err := controller.ParseSNESButton("b+up | l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := controller.ButtonB | controller.ButtonUp | controller.ButtonL; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	for _, s := range []string{"Start", "Select", "Fire1", "B=Fire1"} {
+		if _, err := controller.ParseSNESButton(s); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
+
+func TestC64FunctionRoundTrip(t *testing.T) {
+	sets := []controller.C64Function{controller.Fire1 | controller.AutoFire, 0xFF, 0}
+	for _, f := range append(controller.C64Functions, sets...) {
+		got, err := controller.ParseC64Function(f.String())
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		if got != f {
+			t.Errorf("got %s, want %s", got, f)
+		}
+	}
+
+	if got := (controller.Fire1 | controller.JoyUp).String(); got != "JoyUp|Fire1" {
+		t.Errorf("got %q, want JoyUp|Fire1", got)
+	}
+
+	got, err := controller.ParseC64Function("fire1+AUTOFIRE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := controller.Fire1 | controller.AutoFire; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := controller.ParseC64Function("Fire4"); err == nil {
+		t.Error("got no error for an unknown function")
+	}
+}
+
+func TestEffective(t *testing.T) {
+	for _, tt := range []struct {
+		f, want controller.C64Function
+	}{
+		{controller.AutoFire, 0},
+		{controller.JoyUp | controller.AutoFire, controller.JoyUp},
+		{controller.Fire3 | controller.AutoFire, controller.Fire3 | controller.AutoFire},
+		{controller.Fire1, controller.Fire1},
+	} {
+		if got := tt.f.Effective(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestGamepadMapEdit(t *testing.T) {
+	var g controller.GamepadMap
+
+	g.Set(controller.ButtonB|controller.ButtonY, controller.Fire1, controller.AutoFire)
+	g.Add(controller.ButtonB, controller.JoyUp)
+	if got, want := g.Get(controller.ButtonB), controller.JoyUp|controller.Fire1|controller.AutoFire; got != want {
+		t.Errorf("B: got %s, want %s", got, want)
+	}
+
+	g.Remove(controller.ButtonB|controller.ButtonY, controller.AutoFire)
+	if got, want := g.Functions(controller.ButtonY), []controller.C64Function{controller.Fire1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Y: got %v, want %v", got, want)
+	}
+	if got, want := g.ButtonsFor(controller.Fire1), controller.ButtonB|controller.ButtonY; got != want {
+		t.Errorf("Fire1: got %s, want %s", got, want)
+	}
+
+	g.Clear(controller.ButtonY)
+	if got := g.Get(controller.ButtonY); got != 0 {
+		t.Errorf("Y: got %s after clearing", got)
+	}
+	if got, want := g.Describe(), "B=JoyUp|Fire1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	g.Clear(controller.ButtonB)
+	if got := g.Describe(); got != "none" {
+		t.Errorf("got %q for an empty map", got)
+	}
+}
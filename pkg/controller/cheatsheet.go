@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheatSheetBaseURL is the printable cheat sheet, which takes the maps as
+// concatenated hex in the fragment.
+const CheatSheetBaseURL = "https://snes2c64sheet.shnbk.de/#"
+
+// CheatSheetURL returns the cheat sheet of maps.
+func CheatSheetURL(maps []GamepadMap) string {
+	var builder strings.Builder
+	builder.WriteString(CheatSheetBaseURL)
+	for _, g := range maps {
+		builder.WriteString(strings.ToLower(g.Hex()))
+	}
+
+	return builder.String()
+}
+
+// ParseCheatSheetURL returns the maps of a cheat sheet URL. Only the fragment
+// is read, so URLs of other hosts work as well.
+func ParseCheatSheetURL(s string) ([]GamepadMap, error) {
+	i := strings.IndexByte(s, '#')
+	if i < 0 {
+		return nil, fmt.Errorf("cheat sheet URL %q has no maps", s)
+	}
+
+	return ParseGamepadMaps(s[i+1:])
+}
+
+// IsCheatSheetURL reports whether s looks like a cheat sheet URL rather than
+// a path or port.
+func IsCheatSheetURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTimeout = errors.New("timeout")
+
+// TimeoutError is returned when an operation did not complete within its
+// deadline. It matches ErrTimeout and context.DeadlineExceeded with
+// errors.Is.
+type TimeoutError struct {
+	Op string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, ErrTimeout)
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout || target == context.DeadlineExceeded
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Timeouts bound the individual protocol operations. A zero duration
+// disables the timeout of that operation.
+type Timeouts struct {
+	Connect  time.Duration
+	Version  time.Duration
+	Download time.Duration
+	Upload   time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Connect:  5 * time.Second,
+	Version:  2 * time.Second,
+	Download: 2 * time.Second,
+	Upload:   2 * time.Second,
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, d)
+}
+
+// ctxError converts the error of a finished context into the error returned
+// to callers of op.
+func ctxError(ctx context.Context, op string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Op: op}
+	}
+
+	return fmt.Errorf("%s: %w", op, ctx.Err())
+}
+
+// conn reads the transport in a background goroutine so that reads can be
+// abandoned when their context ends.
+type conn struct {
+	rwc io.ReadWriteCloser
+
+	rx      chan []byte
+	done    chan struct{}
+	readErr error
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(rwc io.ReadWriteCloser) *conn {
+	c := &conn{
+		rwc:     rwc,
+		rx:      make(chan []byte, 16),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+func (c *conn) readLoop() {
+	defer close(c.done)
+
+	for {
+		buf := make([]byte, 128)
+		n, err := c.rwc.Read(buf)
+		if n == 0 && err == nil {
+			// blocking serial reads return nothing once the device is gone
+			err = io.EOF
+		}
+		if n > 0 {
+			select {
+			case c.rx <- buf[:n]:
+			case <-c.closing:
+				return
+			}
+		}
+		if err != nil {
+			c.readErr = err
+			return
+		}
+	}
+}
+
+// discard drops everything received so far, e.g. the rest of a response
+// whose operation timed out.
+func (c *conn) discard() {
+	for {
+		select {
+		case <-c.rx:
+		default:
+			return
+		}
+	}
+}
+
+func (c *conn) write(ctx context.Context, op string, p []byte) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.rwc.Write(p)
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			return fmt.Errorf("failed to write to port: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctxError(ctx, op)
+	}
+}
+
+// readUntil returns everything received until msg has been seen.
+func (c *conn) readUntil(ctx context.Context, op string, msg string) (string, error) {
+	var content strings.Builder
+
+	err := c.readFunc(ctx, op, func(b []byte) (bool, error) {
+		content.Write(b)
+		return strings.Contains(content.String(), msg), nil
+	})
+
+	return content.String(), err
+}
+
+// readFunc passes received chunks to fn until it reports completion or
+// fails.
+func (c *conn) readFunc(ctx context.Context, op string, fn func([]byte) (bool, error)) error {
+	for {
+		var b []byte
+
+		select {
+		case b = <-c.rx:
+		case <-c.done:
+			// the reader may have queued data right before failing
+			select {
+			case b = <-c.rx:
+			default:
+				if errors.Is(c.readErr, io.EOF) {
+					return fmt.Errorf("failed to read from port: %w", io.ErrUnexpectedEOF)
+				}
+				return fmt.Errorf("failed to read from port: %w", c.readErr)
+			}
+		case <-ctx.Done():
+			return ctxError(ctx, op)
+		}
+
+		done, err := fn(b)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (c *conn) close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+	})
+
+	return c.rwc.Close()
+}
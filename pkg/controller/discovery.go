@@ -0,0 +1,405 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// AutoTarget is the target that stands for the best adapter found by
+// Discover.
+const AutoTarget = "auto"
+
+var ErrNoAdapter = errors.New("no adapter found")
+
+type PortInfo struct {
+	Name         string
+	IsUSB        bool
+	VID          string
+	PID          string
+	SerialNumber string
+	Product      string
+}
+
+// usbID identifies the USB serial chips adapters are built with. An empty PID
+// matches every product of the vendor.
+type usbID struct {
+	VID, PID string
+	Chip     string
+}
+
+var adapterUSBIDs = []usbID{
+	{VID: "1A86", PID: "7523", Chip: "CH340"},
+	{VID: "0403", PID: "6001", Chip: "FT232R"},
+	{VID: "10C4", PID: "EA60", Chip: "CP210x"},
+	{VID: "2341", Chip: "Arduino"},
+	{VID: "2A03", Chip: "Arduino"},
+}
+
+// Chip names the USB serial chip if it is one adapters are built with.
+func (p PortInfo) Chip() string {
+	if !p.IsUSB {
+		return ""
+	}
+
+	for _, id := range adapterUSBIDs {
+		if strings.EqualFold(id.VID, p.VID) && (id.PID == "" || strings.EqualFold(id.PID, p.PID)) {
+			return id.Chip
+		}
+	}
+
+	return ""
+}
+
+func (p PortInfo) LikelyAdapter() bool {
+	return p.Chip() != ""
+}
+
+func (p PortInfo) String() string {
+	if !p.IsUSB {
+		return p.Name
+	}
+
+	details := []string{fmt.Sprintf("%s:%s", p.VID, p.PID)}
+	if chip := p.Chip(); chip != "" {
+		details = append(details, chip)
+	}
+	if p.Product != "" {
+		details = append(details, p.Product)
+	}
+	if p.SerialNumber != "" {
+		details = append(details, "serial "+p.SerialNumber)
+	}
+
+	return fmt.Sprintf("%s (%s)", p.Name, strings.Join(details, ", "))
+}
+
+// ListPorts lists the serial ports with their USB details, where the platform
+// provides them.
+func ListPorts() ([]PortInfo, error) {
+	details, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		names, err := serial.GetPortsList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ports: %w", err)
+		}
+
+		ports := make([]PortInfo, len(names))
+		for i, name := range names {
+			ports[i] = PortInfo{Name: name}
+		}
+
+		return ports, nil
+	}
+
+	ports := make([]PortInfo, len(details))
+	for i, d := range details {
+		ports[i] = PortInfo{
+			Name:         d.Name,
+			IsUSB:        d.IsUSB,
+			VID:          strings.ToUpper(d.VID),
+			PID:          strings.ToUpper(d.PID),
+			SerialNumber: d.SerialNumber,
+			Product:      d.Product,
+		}
+	}
+
+	return ports, nil
+}
+
+// Candidate is the result of probing a port for an adapter.
+type Candidate struct {
+	Port PortInfo
+
+	// Banner is true if the port printed SetupCompleteMsg or, not resetting,
+	// answered the version command.
+	Banner bool
+	// Firmware is set if the port also answered the version command.
+	Firmware *FirmwareInfo
+	// Err is the reason the probe failed, if it did.
+	Err error
+}
+
+// Score ranks candidates, higher is more likely an adapter.
+func (c Candidate) Score() int {
+	score := 0
+	if c.Firmware != nil {
+		score += 100
+	}
+	if c.Banner {
+		score += 50
+	}
+	if c.Port.LikelyAdapter() {
+		score += 10
+	}
+	if c.Port.IsUSB {
+		score++
+	}
+
+	return score
+}
+
+// Found reports whether the probe identified an adapter.
+func (c Candidate) Found() bool {
+	return c.Banner
+}
+
+// DefaultProbeTimeout bounds the probe of a single port. It is shorter than
+// DefaultTimeouts.Connect, so a silent port that is no adapter does not use
+// up the time of the connection to the port that is.
+const DefaultProbeTimeout = 3 * time.Second
+
+type DiscoverOptions struct {
+	// Ports to probe, all ports from ListPorts if nil.
+	Ports []PortInfo
+	// Timeout bounds the probe of a single port. It defaults to
+	// DefaultProbeTimeout.
+	Timeout time.Duration
+}
+
+// Probe checks whether an adapter is connected to port.
+func Probe(ctx context.Context, port PortInfo, timeout time.Duration) Candidate {
+	candidate, c := probe(ctx, port, timeout, ControllerOptions{})
+	if c != nil {
+		c.Close()
+	}
+
+	return candidate
+}
+
+// probe connects to port with opts and returns the Controller if the
+// handshake succeeded, for the caller to keep or close. The banner window is
+// half of timeout unless opts sets a shorter one, leaving time to ask an
+// adapter that does not reset for its version.
+func probe(ctx context.Context, port PortInfo, timeout time.Duration, opts ControllerOptions) (Candidate, *Controller) {
+	candidate := Candidate{Port: port}
+
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	if opts.BannerWindow == 0 || opts.BannerWindow > timeout/2 {
+		opts.BannerWindow = timeout / 2
+	}
+
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	t, err := openTransport(ctx, port.Name, opts.serialSettings())
+	if err != nil {
+		candidate.Err = fmt.Errorf("failed to open port: %w", err)
+		return candidate, nil
+	}
+
+	c, err := newController(ctx, t, opts)
+	if err != nil {
+		candidate.Err = err
+		return candidate, nil
+	}
+
+	candidate.Banner = true
+
+	info, err := c.FirmwareInfoContext(ctx)
+	if err != nil {
+		candidate.Err = err
+		return candidate, c
+	}
+	candidate.Firmware = &info
+
+	return candidate, c
+}
+
+// probed is a Candidate with the Controller of its probe, if the handshake
+// succeeded.
+type probed struct {
+	Candidate
+	controller *Controller
+}
+
+// Discover probes the ports in parallel and returns them ranked by how
+// likely they are an adapter.
+func Discover(ctx context.Context, opts DiscoverOptions) ([]Candidate, error) {
+	results, err := discover(ctx, opts, func(PortInfo) ControllerOptions {
+		return ControllerOptions{}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]Candidate, len(results))
+	for i, r := range results {
+		if r.controller != nil {
+			r.controller.Close()
+		}
+		candidates[i] = r.Candidate
+	}
+
+	return candidates, nil
+}
+
+// discover probes the ports in parallel, each with the options returned by
+// optsFor, and returns the ranked results. The caller closes the
+// controllers.
+func discover(ctx context.Context, opts DiscoverOptions, optsFor func(PortInfo) ControllerOptions) ([]probed, error) {
+	ports := opts.Ports
+	if ports == nil {
+		var err error
+		if ports, err = ListPorts(); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]probed, len(ports))
+
+	var wg sync.WaitGroup
+	for i := range ports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			candidate, c := probe(ctx, ports[i], opts.Timeout, optsFor(ports[i]))
+			results[i] = probed{Candidate: candidate, controller: c}
+		}(i)
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score() != results[j].Score() {
+			return results[i].Score() > results[j].Score()
+		}
+		return results[i].Port.Name < results[j].Port.Name
+	})
+
+	return results, nil
+}
+
+// detected is an adapter found by probing, with the connection of its probe.
+type detected struct {
+	controller *Controller
+	port       string
+}
+
+// openDetected probes with opts and keeps the connections of the adapters
+// found, best first, so no adapter is reset a second time by reopening its
+// port. It keeps at most limit connections unless limit is 0 and closes the
+// others.
+func openDetected(ctx context.Context, dopts DiscoverOptions, opts ControllerOptions, limit int) ([]detected, error) {
+	traces := map[string]*pendingTrace{}
+	var mu sync.Mutex
+
+	results, err := discover(ctx, dopts, func(port PortInfo) ControllerOptions {
+		probeOpts := opts
+		// the options that outlive the probe are set on the kept connection
+		probeOpts.Reconnect = nil
+		probeOpts.OnStateChange = nil
+		if opts.Trace != nil {
+			trace := &pendingTrace{}
+			mu.Lock()
+			traces[port.Name] = trace
+			mu.Unlock()
+			probeOpts.Trace = trace
+		}
+
+		return probeOpts
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []detected
+	for _, r := range results {
+		if r.Found() && r.controller != nil && (limit == 0 || len(kept) < limit) {
+			kept = append(kept, detected{controller: r.controller, port: r.Port.Name})
+			continue
+		}
+		if r.controller != nil {
+			r.controller.Close()
+		}
+	}
+	if len(kept) == 0 {
+		return nil, ErrNoAdapter
+	}
+
+	for _, d := range kept {
+		if trace := traces[d.port]; trace != nil {
+			if err := trace.attach(opts.Trace); err != nil {
+				for _, d := range kept {
+					d.controller.Close()
+				}
+				return nil, fmt.Errorf("failed to write trace: %w", err)
+			}
+		}
+
+		port := d.port
+		d.controller.opts = opts
+		// reconnecting reopens the port found, it does not search again
+		d.controller.reopen = func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return openTransport(ctx, port, opts.serialSettings())
+		}
+	}
+
+	return kept, nil
+}
+
+// openAuto connects to the best adapter found by probing with opts and
+// keeps the connection of the probe. It returns the port of the adapter.
+func openAuto(ctx context.Context, dopts DiscoverOptions, opts ControllerOptions) (*Controller, string, error) {
+	kept, err := openDetected(ctx, dopts, opts, 1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return kept[0].controller, kept[0].port, nil
+}
+
+// pendingTrace holds the trace of a probe until the probe turns out to be
+// the connection that is kept.
+type pendingTrace struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	w   io.Writer
+}
+
+func (t *pendingTrace) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.w != nil {
+		return t.w.Write(p)
+	}
+
+	return t.buf.Write(p)
+}
+
+// attach writes the trace so far to w and passes the following events on.
+func (t *pendingTrace) attach(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.w = w
+	_, err := w.Write(t.buf.Bytes())
+	t.buf.Reset()
+
+	return err
+}
+
+// DiscoverBest returns the port of the most likely adapter.
+func DiscoverBest(ctx context.Context, opts DiscoverOptions) (PortInfo, error) {
+	candidates, err := Discover(ctx, opts)
+	if err != nil {
+		return PortInfo{}, err
+	}
+
+	if len(candidates) == 0 || !candidates[0].Found() {
+		return PortInfo{}, ErrNoAdapter
+	}
+
+	return candidates[0].Port, nil
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveAdapter imitates an adapter that boots on every connection.
+func serveAdapter(device io.ReadWriteCloser) {
+	defer device.Close()
+
+	if _, err := io.WriteString(device, "snes2c64\r\n"+SetupCompleteMsg+"\r\n"); err != nil {
+		return
+	}
+
+	buf := make([]byte, 1)
+	for {
+		if _, err := device.Read(buf); err != nil {
+			return
+		}
+		if string(buf) == FirmwareVersionCmd {
+			if _, err := io.WriteString(device, "snes2c64 v1.0.0\r\n"+FirmwareVersionCompleteMsg+"\r\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveSilent imitates a port without an adapter.
+func serveSilent(device io.ReadWriteCloser) {
+	defer device.Close()
+
+	_, _ = io.Copy(io.Discard, device)
+}
+
+func TestOpenAutoKeepsProbe(t *testing.T) {
+	var adapterOpens, silentOpens atomic.Int32
+	RegisterMemDevice("auto-adapter", func(device io.ReadWriteCloser) {
+		adapterOpens.Add(1)
+		serveAdapter(device)
+	})
+	RegisterMemDevice("auto-silent", func(device io.ReadWriteCloser) {
+		silentOpens.Add(1)
+		serveSilent(device)
+	})
+	defer UnregisterMemDevice("auto-adapter")
+	defer UnregisterMemDevice("auto-silent")
+
+	dopts := DiscoverOptions{
+		Ports:   []PortInfo{{Name: "mem://auto-silent"}, {Name: "mem://auto-adapter"}},
+		Timeout: 300 * time.Millisecond,
+	}
+
+	// the silent port must not use up the time of the connection
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var trace bytes.Buffer
+	c, port, err := openAuto(ctx, dopts, ControllerOptions{Trace: &trace})
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer c.Close()
+
+	if port != "mem://auto-adapter" {
+		t.Errorf("got port %s, want mem://auto-adapter", port)
+	}
+
+	info, err := c.FirmwareInfoContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to use the kept connection: %v", err)
+	}
+	if info.Version.String() != "1.0.0" {
+		t.Errorf("got firmware %s, want 1.0.0", info.Version)
+	}
+
+	if n := adapterOpens.Load(); n != 1 {
+		t.Errorf("adapter port opened %d times, want 1", n)
+	}
+	if n := silentOpens.Load(); n != 1 {
+		t.Errorf("silent port opened %d times, want 1", n)
+	}
+
+	// the trace holds the probe of the adapter only, from the banner on
+	events, err := ReadTrace(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[0].Dir != TraceOpen {
+		t.Fatalf("trace does not start with an open event: %v", events)
+	}
+	var rx strings.Builder
+	for _, e := range events {
+		if e.Dir == TraceOpen && e != events[0] {
+			t.Errorf("trace holds more than one session")
+		}
+		if e.Dir == TraceRx {
+			b, _ := e.Bytes()
+			rx.Write(b)
+		}
+	}
+	if !strings.Contains(rx.String(), SetupCompleteMsg) {
+		t.Errorf("trace misses the boot banner: %q", rx.String())
+	}
+}
+
+func TestManagerOpenDetectedKeepsProbes(t *testing.T) {
+	names := []string{"detect-a", "detect-b"}
+	opens := make([]atomic.Int32, len(names))
+	for i, name := range names {
+		i := i
+		RegisterMemDevice(name, func(device io.ReadWriteCloser) {
+			opens[i].Add(1)
+			serveAdapter(device)
+		})
+		defer UnregisterMemDevice(name)
+	}
+	RegisterMemDevice("detect-silent", serveSilent)
+	defer UnregisterMemDevice("detect-silent")
+
+	dopts := DiscoverOptions{
+		Ports: []PortInfo{
+			{Name: "mem://detect-silent"},
+			{Name: "mem://detect-b"},
+			{Name: "mem://detect-a"},
+		},
+		Timeout: 300 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	m := NewManager(ControllerOptions{})
+	defer m.CloseAll()
+
+	results, err := m.OpenDetected(ctx, dopts)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(results))
+	}
+
+	got := m.Each(ctx, func(ctx context.Context, s *Session) error {
+		_, err := s.Controller.FirmwareInfoContext(ctx)
+		return err
+	})
+	want := []string{"mem://detect-a", "mem://detect-b"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sessions, want %d", len(got), len(want))
+	}
+	for i, r := range got {
+		if r.Session.Name != want[i] {
+			t.Errorf("session %d is %s, want %s", i, r.Session.Name, want[i])
+		}
+		if r.Err != nil {
+			t.Errorf("failed to use the kept connection of %s: %v", r.Session.Name, r.Err)
+		}
+	}
+
+	for i, name := range names {
+		if n := opens[i].Load(); n != 1 {
+			t.Errorf("%s opened %d times, want 1", name, n)
+		}
+	}
+
+	// probing again does not replace the sessions
+	results, err = m.OpenDetected(ctx, dopts)
+	if err != nil {
+		t.Fatalf("failed to probe again: %v", err)
+	}
+	for _, r := range results {
+		if !errors.Is(r.Err, ErrSessionExists) {
+			t.Errorf("got %v for %s, want ErrSessionExists", r.Err, r.Session.Name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupported     = errors.New("not supported by the adapter firmware")
+	ErrInvalidVersion  = errors.New("invalid firmware version")
+	ErrMissingVersion  = errors.New("firmware did not report a version")
+	versionRegexp      = regexp.MustCompile(`v?(\d+)\.(\d+)(?:\.(\d+))?`)
+	buildDateLayouts   = []string{"2006-01-02", "2006-01-02 15:04:05", "Jan _2 2006", "Jan _2 2006 15:04:05"}
+	legacyCommandNames = []string{FirmwareVersionCmd, DownloadCmd, UploadCmd}
+)
+
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion parses versions like "1.2.3", "v1.2" or "snes2c64 v1.2.3".
+func ParseVersion(s string) (Version, error) {
+	m := versionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("%w: %q", ErrInvalidVersion, s)
+	}
+
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+
+	return v, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 if v is older than, equal to or newer than o.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (v Version) AtLeast(o Version) bool {
+	return v.Compare(o) >= 0
+}
+
+// Feature is an operation that needs a firmware command and a minimum
+// firmware version.
+type Feature struct {
+	Name       string
+	Command    string
+	MinVersion Version
+}
+
+var (
+	FeatureVersion  = Feature{Name: "firmware version", Command: FirmwareVersionCmd, MinVersion: Version{1, 0, 0}}
+	FeatureDownload = Feature{Name: "download", Command: DownloadCmd, MinVersion: Version{1, 0, 0}}
+	FeatureUpload   = Feature{Name: "upload", Command: UploadCmd, MinVersion: Version{1, 0, 0}}
+)
+
+// UnsupportedError is returned when the firmware is too old for a feature or
+// lacks its command. It matches ErrUnsupported with errors.Is.
+type UnsupportedError struct {
+	Feature  Feature
+	Firmware Version
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Firmware.Compare(e.Feature.MinVersion) < 0 {
+		return fmt.Sprintf("%s requires firmware %s or newer, the adapter runs %s", e.Feature.Name, e.Feature.MinVersion, e.Firmware)
+	}
+
+	return fmt.Sprintf("%s requires the %q command, which firmware %s does not offer", e.Feature.Name, e.Feature.Command, e.Firmware)
+}
+
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// FirmwareInfo is the parsed reply to the firmware version command. Fields
+// that older firmware does not report are set to the values these versions
+// are known to have.
+type FirmwareInfo struct {
+	Version Version
+	// BuildDate is zero if the firmware does not report it.
+	BuildDate time.Time
+	// Hardware is the hardware revision, empty if the firmware does not
+	// report it.
+	Hardware string
+
+	MapSlots      int
+	ButtonsPerMap int
+	Commands      []string
+	// Protocols are the protocols the firmware speaks, only ProtocolText if
+	// it does not report them.
+	Protocols []Protocol
+
+	// Raw is the reply without its terminator.
+	Raw string
+}
+
+// ParseFirmwareInfo parses a version reply made of "Key: Value" lines, as
+// well as the single version line of older firmware.
+func ParseFirmwareInfo(raw string) (FirmwareInfo, error) {
+	info := FirmwareInfo{
+		MapSlots:      MapCount,
+		ButtonsPerMap: ButtonCount,
+		Commands:      legacyCommandNames,
+		Protocols:     []Protocol{ProtocolText},
+		Raw:           raw,
+	}
+
+	var versionFound bool
+	for _, line := range strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			if !versionFound {
+				if v, err := ParseVersion(line); err == nil {
+					info.Version = v
+					versionFound = true
+				}
+			}
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "version":
+			info.Version, err = ParseVersion(value)
+			versionFound = err == nil
+		case "build":
+			// an unknown date format does not make the rest of the reply useless
+			info.BuildDate, _ = parseBuildDate(value)
+		case "hardware":
+			info.Hardware = value
+		case "slots":
+			info.MapSlots, err = strconv.Atoi(value)
+		case "buttons":
+			info.ButtonsPerMap, err = strconv.Atoi(value)
+		case "commands":
+			info.Commands = strings.Fields(value)
+		case "protocols":
+			info.Protocols = nil
+			for _, p := range strings.Fields(value) {
+				info.Protocols = append(info.Protocols, Protocol(p))
+			}
+		}
+		if err != nil {
+			return FirmwareInfo{}, fmt.Errorf("failed to parse firmware %s: %w", strings.ToLower(strings.TrimSpace(key)), err)
+		}
+	}
+
+	if !versionFound {
+		return FirmwareInfo{}, fmt.Errorf("%w: %q", ErrMissingVersion, raw)
+	}
+
+	// maps are exchanged as ButtonCount bytes, which other firmware would
+	// misread
+	if info.ButtonsPerMap != ButtonCount {
+		return FirmwareInfo{}, fmt.Errorf("%w: firmware %s has %d buttons per map, want %d", ErrWrongButtonCount, info.Version, info.ButtonsPerMap, ButtonCount)
+	}
+
+	return info, nil
+}
+
+func parseBuildDate(s string) (time.Time, error) {
+	for _, layout := range buildDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
+}
+
+func (f FirmwareInfo) HasCommand(cmd string) bool {
+	for _, c := range f.Commands {
+		if c == cmd {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f FirmwareInfo) HasProtocol(p Protocol) bool {
+	for _, fp := range f.Protocols {
+		if fp == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f FirmwareInfo) Supports(feature Feature) bool {
+	return f.Require(feature) == nil
+}
+
+// Require returns an UnsupportedError if the firmware cannot perform feature.
+func (f FirmwareInfo) Require(feature Feature) error {
+	if !f.Version.AtLeast(feature.MinVersion) || !f.HasCommand(feature.Command) {
+		return &UnsupportedError{
+			Feature:  feature,
+			Firmware: f.Version,
+		}
+	}
+
+	return nil
+}
+
+// String summarizes the firmware on a single line.
+func (f FirmwareInfo) String() string {
+	var details []string
+	if f.Hardware != "" {
+		details = append(details, "hardware "+f.Hardware)
+	}
+	if !f.BuildDate.IsZero() {
+		details = append(details, "built "+f.BuildDate.Format("2006-01-02"))
+	}
+	details = append(details, fmt.Sprintf("%d maps", f.MapSlots))
+
+	return fmt.Sprintf("Firmware %s (%s)", f.Version, strings.Join(details, ", "))
+}
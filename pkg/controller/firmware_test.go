@@ -0,0 +1,36 @@
+package controller_test
+
+import (
+	"errors"
+	"testing"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func TestParseFirmwareInfoButtons(t *testing.T) {
+	info, err := controller.ParseFirmwareInfo("Version: 1.2.0\r\nSlots: 8\r\nButtons: 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ButtonsPerMap != controller.ButtonCount {
+		t.Errorf("got %d buttons per map, want %d", info.ButtonsPerMap, controller.ButtonCount)
+	}
+
+	// older firmware does not report the buttons
+	info, err = controller.ParseFirmwareInfo("snes2c64 v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ButtonsPerMap != controller.ButtonCount {
+		t.Errorf("got %d buttons per map, want %d", info.ButtonsPerMap, controller.ButtonCount)
+	}
+
+	for _, raw := range []string{
+		"Version: 1.2.0\r\nButtons: 12",
+		"Version: 1.2.0\r\nButtons: 0",
+	} {
+		if _, err := controller.ParseFirmwareInfo(raw); !errors.Is(err, controller.ErrWrongButtonCount) {
+			t.Errorf("%q: got %v, want %v", raw, err, controller.ErrWrongButtonCount)
+		}
+	}
+}
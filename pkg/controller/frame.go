@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Protocol selects how commands and responses are encoded.
+type Protocol string
+
+const (
+	// ProtocolAuto uses the framed protocol if the firmware reports it and
+	// the text protocol otherwise.
+	ProtocolAuto Protocol = "auto"
+	// ProtocolText sends the single letter commands and searches the
+	// responses for their terminators, like all firmware understands.
+	ProtocolText Protocol = "text"
+	// ProtocolFramed wraps commands and responses in frames with a length
+	// and a checksum, so corrupted or lost bytes are detected.
+	ProtocolFramed Protocol = "framed"
+)
+
+// ParseProtocol parses "auto", "text" or "framed".
+func ParseProtocol(s string) (Protocol, error) {
+	switch p := Protocol(s); p {
+	case ProtocolAuto, ProtocolText, ProtocolFramed:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid protocol %q", s)
+	}
+}
+
+// A frame is FrameStart, the payload length, the command, the payload and
+// the CRC-16 of length, command and payload, most significant byte first.
+// The commands are those of the text protocol. The adapter answers with a
+// frame of the same command, or of FrameErrorCmd with the error message as
+// payload, e.g. if the checksum of the request did not match.
+const (
+	FrameStart      = 0xA5
+	FrameErrorCmd   = 'E'
+	MaxFramePayload = 255
+)
+
+var (
+	ErrChecksum      = errors.New("checksum mismatch")
+	ErrFrameTooLarge = errors.New("frame too large")
+	ErrRejected      = errors.New("rejected by the adapter")
+)
+
+type Frame struct {
+	Cmd     byte
+	Payload []byte
+}
+
+// MarshalBinary encodes f including start byte and checksum.
+func (f Frame) MarshalBinary() ([]byte, error) {
+	if len(f.Payload) > MaxFramePayload {
+		return nil, fmt.Errorf("%w: %d bytes of payload", ErrFrameTooLarge, len(f.Payload))
+	}
+
+	b := make([]byte, 0, len(f.Payload)+5)
+	b = append(b, FrameStart, byte(len(f.Payload)), f.Cmd)
+	b = append(b, f.Payload...)
+
+	crc := CRC16(b[1:])
+
+	return append(b, byte(crc>>8), byte(crc)), nil
+}
+
+// CRC16 returns the CRC-16/CCITT-FALSE of b: polynomial 0x1021, initial
+// value 0xFFFF, as computed by the firmware.
+func CRC16(b []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, v := range b {
+		crc ^= uint16(v) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// frameParser collects a frame from the chunks of a response. Bytes before
+// FrameStart, like a late boot banner, are skipped.
+type frameParser struct {
+	buf   []byte
+	frame Frame
+}
+
+func (p *frameParser) Write(b []byte) (bool, error) {
+	p.buf = append(p.buf, b...)
+
+	if len(p.buf) > 0 && p.buf[0] != FrameStart {
+		i := 0
+		for i < len(p.buf) && p.buf[i] != FrameStart {
+			i++
+		}
+		p.buf = p.buf[i:]
+	}
+
+	if len(p.buf) < 3 {
+		return false, nil
+	}
+
+	n := 3 + int(p.buf[1]) + 2
+	if len(p.buf) < n {
+		return false, nil
+	}
+
+	want := uint16(p.buf[n-2])<<8 | uint16(p.buf[n-1])
+	if got := CRC16(p.buf[1 : n-2]); got != want {
+		return false, fmt.Errorf("%w: got %04X, want %04X", ErrChecksum, got, want)
+	}
+
+	p.frame = Frame{
+		Cmd:     p.buf[2],
+		Payload: append([]byte(nil), p.buf[3:n-2]...),
+	}
+
+	return true, nil
+}
+
+// ReadFrame reads the next frame from r, skipping bytes before FrameStart.
+// It returns io.ErrUnexpectedEOF if r ends within a frame.
+func ReadFrame(r io.ByteReader) (Frame, error) {
+	var p frameParser
+
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && len(p.buf) > 0 {
+			return Frame{}, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return Frame{}, err
+		}
+
+		done, err := p.Write([]byte{b})
+		if err != nil {
+			return Frame{}, err
+		}
+		if done {
+			return p.frame, nil
+		}
+	}
+}
+
+// exchange sends req and returns the response of the same command.
+func (c *conn) exchange(ctx context.Context, op string, req Frame) (Frame, error) {
+	b, err := req.MarshalBinary()
+	if err != nil {
+		return Frame{}, err
+	}
+
+	c.discard()
+
+	if err := c.write(ctx, op, b); err != nil {
+		return Frame{}, err
+	}
+
+	var p frameParser
+	if err := c.readFunc(ctx, op, p.Write); err != nil {
+		if errors.Is(err, ErrChecksum) {
+			return Frame{}, fmt.Errorf("%s: %w", op, err)
+		}
+		return Frame{}, err
+	}
+
+	switch p.frame.Cmd {
+	case req.Cmd:
+		return p.frame, nil
+	case FrameErrorCmd:
+		return Frame{}, fmt.Errorf("%s: %w: %s", op, ErrRejected, p.frame.Payload)
+	default:
+		return Frame{}, fmt.Errorf("%s: unexpected response %q", op, p.frame.Cmd)
+	}
+}
+
+// negotiate selects the protocol for the following operations. It queries
+// the firmware info, which tells the protocols, unless the text protocol is
+// forced.
+func (c *Controller) negotiate(ctx context.Context) error {
+	if c.opts.Protocol == ProtocolText {
+		return nil
+	}
+
+	if c.info == nil {
+		if _, err := c.firmwareInfo(ctx); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.Protocol == ProtocolFramed && !c.framed {
+		return fmt.Errorf("%w: firmware %s does not offer the framed protocol", ErrUnsupported, c.info.Version)
+	}
+
+	return nil
+}
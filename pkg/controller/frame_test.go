@@ -0,0 +1,84 @@
+package controller_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func TestCRC16(t *testing.T) {
+	// the check value of CRC-16/CCITT-FALSE
+	if got := controller.CRC16([]byte("123456789")); got != 0x29B1 {
+		t.Errorf("got %04X, want 29B1", got)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, f := range []controller.Frame{
+		{Cmd: 'v'},
+		{Cmd: 'u', Payload: []byte{3, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x00, 0x00, 0xA5}},
+		{Cmd: 'd', Payload: bytes.Repeat([]byte{0xFF}, controller.MaxFramePayload)},
+	} {
+		b, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != len(f.Payload)+5 || b[0] != controller.FrameStart {
+			t.Errorf("%q: malformed frame % X", f.Cmd, b)
+		}
+
+		// noise before the frame, like a late boot banner, is skipped
+		got, err := controller.ReadFrame(bytes.NewReader(append([]byte("Setup complete.\r\n"), b...)))
+		if err != nil {
+			t.Fatalf("%q: %v", f.Cmd, err)
+		}
+		if got.Cmd != f.Cmd || !bytes.Equal(got.Payload, f.Payload) {
+			t.Errorf("got %q % X, want %q % X", got.Cmd, got.Payload, f.Cmd, f.Payload)
+		}
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	f := controller.Frame{Cmd: 'u', Payload: make([]byte, controller.MaxFramePayload+1)}
+	if _, err := f.MarshalBinary(); !errors.Is(err, controller.ErrFrameTooLarge) {
+		t.Errorf("got %v, want %v", err, controller.ErrFrameTooLarge)
+	}
+}
+
+func TestReadFrameCorrupted(t *testing.T) {
+	b, err := controller.Frame{Cmd: 'u', Payload: []byte{3, 1, 2, 4, 8, 16, 32, 64, 0, 0, 0}}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a bit in the command, the payload and the checksum; a changed
+	// length would read past the end of the frame instead
+	for i := 2; i < len(b); i++ {
+		corrupted := append([]byte(nil), b...)
+		corrupted[i] ^= 0x10
+
+		if _, err := controller.ReadFrame(bytes.NewReader(corrupted)); !errors.Is(err, controller.ErrChecksum) {
+			t.Errorf("byte %d: got %v, want %v", i, err, controller.ErrChecksum)
+		}
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	b, err := controller.Frame{Cmd: 'v', Payload: []byte("1.2.0")}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 1; n < len(b); n++ {
+		if _, err := controller.ReadFrame(bytes.NewReader(b[:n])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%d of %d bytes: got %v, want %v", n, len(b), err, io.ErrUnexpectedEOF)
+		}
+	}
+
+	if _, err := controller.ReadFrame(bytes.NewReader(nil)); err != io.EOF {
+		t.Errorf("empty input: got %v, want %v", err, io.EOF)
+	}
+}
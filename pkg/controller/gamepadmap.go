@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Hex encodes g as 20 hex digits, the format of the CLI and cheat sheet.
+func (g GamepadMap) Hex() string {
+	return strings.ToUpper(hex.EncodeToString(g[:]))
+}
+
+// ParseGamepadMap parses the 20 hex digits of a map.
+func ParseGamepadMap(s string) (GamepadMap, error) {
+	var g GamepadMap
+
+	if len(s) != 2*ButtonCount {
+		return g, fmt.Errorf("map %q must have %d hex digits", s, 2*ButtonCount)
+	}
+
+	if _, err := hex.Decode(g[:], []byte(s)); err != nil {
+		return g, fmt.Errorf("failed to parse map %q: %w", s, err)
+	}
+
+	return g, nil
+}
+
+// ParseGamepadMaps parses a list of maps, either separated by commas or
+// whitespace or concatenated like in the cheat sheet URL.
+func ParseGamepadMaps(s string) ([]GamepadMap, error) {
+	digits := strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	}), "")
+
+	if len(digits)%(2*ButtonCount) != 0 {
+		return nil, fmt.Errorf("maps must have a multiple of %d hex digits, got %d", 2*ButtonCount, len(digits))
+	}
+
+	maps := make([]GamepadMap, 0, len(digits)/(2*ButtonCount))
+	for i := 0; i < len(digits); i += 2 * ButtonCount {
+		g, err := ParseGamepadMap(digits[i : i+2*ButtonCount])
+		if err != nil {
+			return nil, err
+		}
+
+		maps = append(maps, g)
+	}
+
+	return maps, nil
+}
+
+// MarshalText encodes g as hex like Hex, so g is a string in JSON and YAML.
+func (g GamepadMap) MarshalText() ([]byte, error) {
+	return []byte(g.Hex()), nil
+}
+
+func (g *GamepadMap) UnmarshalText(text []byte) error {
+	m, err := ParseGamepadMap(string(text))
+	if err != nil {
+		return err
+	}
+	*g = m
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrSessionExists = errors.New("session exists")
+
+// Session is an open connection to one of several adapters.
+type Session struct {
+	Name       string
+	Target     string
+	Controller *Controller
+}
+
+// SessionResult is the outcome of an operation on a session.
+type SessionResult struct {
+	Session *Session
+	Err     error
+}
+
+// Manager keeps named connections to several adapters, e.g. one per C64
+// joystick port.
+type Manager struct {
+	opts ControllerOptions
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewManager returns a Manager opening its sessions with opts.
+func NewManager(opts ControllerOptions) *Manager {
+	return &Manager{
+		opts:     opts,
+		sessions: map[string]*Session{},
+	}
+}
+
+// Open connects to target as session name. An empty name uses the target.
+func (m *Manager) Open(ctx context.Context, name, target string) (*Session, error) {
+	return m.OpenWithOptions(ctx, name, target, m.opts)
+}
+
+// OpenWithOptions is Open with options other than those of the Manager, e.g.
+// a trace per session.
+func (m *Manager) OpenWithOptions(ctx context.Context, name, target string, opts ControllerOptions) (*Session, error) {
+	if name == "" {
+		name = target
+	}
+
+	m.mu.Lock()
+	_, exists := m.sessions[name]
+	m.mu.Unlock()
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+
+	c, err := OpenWithOptions(ctx, target, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		Name:       name,
+		Target:     target,
+		Controller: c,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// another Open of the same name may have won the race
+	if _, exists := m.sessions[name]; exists {
+		c.Close()
+		return nil, fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	m.sessions[name] = s
+
+	return s, nil
+}
+
+// OpenAll connects to the targets in parallel, naming the sessions after
+// their targets. The results are in the order of targets; failed sessions
+// are not kept.
+func (m *Manager) OpenAll(ctx context.Context, targets []string) []SessionResult {
+	results := make([]SessionResult, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+
+			s, err := m.Open(ctx, "", target)
+			if s == nil {
+				s = &Session{Name: target, Target: target}
+			}
+			results[i] = SessionResult{Session: s, Err: err}
+		}(i, target)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// OpenDetected probes the ports for adapters and keeps the connections of
+// the probes as sessions named after their ports, so no adapter is reset a
+// second time by reopening its port. It returns ErrNoAdapter if no port
+// answered.
+func (m *Manager) OpenDetected(ctx context.Context, opts DiscoverOptions) ([]SessionResult, error) {
+	kept, err := openDetected(ctx, opts, m.opts, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := make([]SessionResult, len(kept))
+	for i, d := range kept {
+		s := &Session{Name: d.port, Target: d.port, Controller: d.controller}
+		if _, exists := m.sessions[d.port]; exists {
+			d.controller.Close()
+			results[i] = SessionResult{
+				Session: &Session{Name: d.port, Target: d.port},
+				Err:     fmt.Errorf("%w: %s", ErrSessionExists, d.port),
+			}
+			continue
+		}
+		m.sessions[d.port] = s
+		results[i] = SessionResult{Session: s}
+	}
+
+	return results, nil
+}
+
+// Get returns the session name.
+func (m *Manager) Get(name string) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[name]
+
+	return s, ok
+}
+
+// Sessions returns the open sessions ordered by name.
+func (m *Manager) Sessions() []*Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name < sessions[j].Name
+	})
+
+	return sessions
+}
+
+// Close closes and forgets the session name.
+func (m *Manager) Close(name string) error {
+	m.mu.Lock()
+	s, ok := m.sessions[name]
+	delete(m.sessions, name)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no session %s", name)
+	}
+
+	return s.Controller.Close()
+}
+
+// CloseAll closes all sessions.
+func (m *Manager) CloseAll() error {
+	var firstErr error
+	for _, s := range m.Sessions() {
+		if err := m.Close(s.Name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Each runs fn on every session in parallel and returns the results ordered
+// by session name. A failing session does not stop the others.
+func (m *Manager) Each(ctx context.Context, fn func(context.Context, *Session) error) []SessionResult {
+	sessions := m.Sessions()
+	results := make([]SessionResult, len(sessions))
+
+	var wg sync.WaitGroup
+	for i, s := range sessions {
+		wg.Add(1)
+		go func(i int, s *Session) {
+			defer wg.Done()
+			results[i] = SessionResult{Session: s, Err: fn(ctx, s)}
+		}(i, s)
+	}
+	wg.Wait()
+
+	return results
+}
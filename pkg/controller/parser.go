@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMalformedLine      = errors.New("malformed line")
+	ErrWrongButtonCount   = errors.New("wrong button count")
+	ErrUnexpectedMapCount = errors.New("unexpected map count")
+)
+
+// ParseError describes where a download response could not be parsed. It
+// wraps one of ErrMalformedLine, ErrWrongButtonCount or
+// ErrUnexpectedMapCount.
+type ParseError struct {
+	Err error
+
+	// Line is the offending line without its line ending.
+	Line string
+	// Offset is the byte offset of Line in the response.
+	Offset int
+	// Detail explains the problem in more depth, if available.
+	Detail string
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%v at offset %d: %q", e.Err, e.Offset, e.Line)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// downloadParser consumes the response of the download command as it
+// arrives. Everything up to the line ending in DownloadStartMsg is ignored,
+// which skips boot messages and other noise. Both CRLF and LF line endings
+// are accepted, as are blank lines and surrounding whitespace.
+type downloadParser struct {
+	// mapCount is the number of maps to expect, MapCount if zero.
+	mapCount int
+
+	// pending holds the incomplete last line and starts at offset.
+	pending []byte
+	offset  int
+
+	started bool
+	done    bool
+	maps    []GamepadMap
+}
+
+// Write feeds a chunk of the response to the parser. It reports whether the
+// response is complete.
+func (p *downloadParser) Write(b []byte) (bool, error) {
+	p.pending = append(p.pending, b...)
+
+	for !p.done {
+		i := bytes.IndexByte(p.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := string(p.pending[:i])
+		if err := p.line(line, p.offset); err != nil {
+			return false, err
+		}
+
+		p.pending = p.pending[i+1:]
+		p.offset += i + 1
+	}
+
+	// the terminator does not need a line ending, as no map line can start
+	// with it
+	if !p.done && p.started && strings.TrimSpace(string(p.pending)) == DownloadCompleteMsg {
+		if err := p.line(string(p.pending), p.offset); err != nil {
+			return false, err
+		}
+	}
+
+	return p.done, nil
+}
+
+func (p *downloadParser) line(raw string, offset int) error {
+	line := strings.TrimSpace(raw)
+
+	if !p.started {
+		p.started = strings.HasSuffix(line, DownloadStartMsg)
+		return nil
+	}
+
+	switch line {
+	case "":
+		return nil
+	case DownloadCompleteMsg:
+		mapCount := p.mapCount
+		if mapCount == 0 {
+			mapCount = MapCount
+		}
+
+		if len(p.maps) != mapCount {
+			return &ParseError{
+				Err:    ErrUnexpectedMapCount,
+				Line:   strings.TrimRight(raw, "\r"),
+				Offset: offset,
+				Detail: fmt.Sprintf("got %d maps, want %d", len(p.maps), mapCount),
+			}
+		}
+
+		p.done = true
+		return nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != ButtonCount {
+		return &ParseError{
+			Err:    ErrWrongButtonCount,
+			Line:   strings.TrimRight(raw, "\r"),
+			Offset: offset,
+			Detail: fmt.Sprintf("got %d buttons, want %d", len(fields), ButtonCount),
+		}
+	}
+
+	var g GamepadMap
+	for i, field := range fields {
+		functions, err := strconv.ParseUint(field, 16, 8)
+		if err != nil {
+			return &ParseError{
+				Err:    ErrMalformedLine,
+				Line:   strings.TrimRight(raw, "\r"),
+				Offset: offset,
+				Detail: fmt.Sprintf("button %d: %v", i, err),
+			}
+		}
+
+		g[i] = uint8(functions)
+	}
+
+	p.maps = append(p.maps, g)
+
+	return nil
+}
+
+// parseFramedMaps splits the payload of a framed download, the map bytes
+// without any separators, into mapCount maps.
+func parseFramedMaps(payload []byte, mapCount int) ([]GamepadMap, error) {
+	if len(payload) != mapCount*ButtonCount {
+		return nil, &ParseError{
+			Err:    ErrUnexpectedMapCount,
+			Line:   fmt.Sprintf("%X", payload),
+			Detail: fmt.Sprintf("got %d bytes, want %d maps of %d buttons", len(payload), mapCount, ButtonCount),
+		}
+	}
+
+	maps := make([]GamepadMap, mapCount)
+	for i := range maps {
+		copy(maps[i][:], payload[i*ButtonCount:])
+	}
+
+	return maps, nil
+}
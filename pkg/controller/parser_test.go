@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testMapLine = "01 02 04 08 10 20 40 00 00 00"
+
+func TestDownloadParser(t *testing.T) {
+	response := "boot noise\r\nSTART\r\n" + testMapLine + "\r\n\r\n  " + testMapLine + "  \nEND"
+
+	// feed the response in small chunks, like it arrives from the port
+	p := downloadParser{mapCount: 2}
+	var done bool
+	for i := 0; i < len(response); i += 3 {
+		end := i + 3
+		if end > len(response) {
+			end = len(response)
+		}
+
+		var err error
+		if done, err = p.Write([]byte(response[i:end])); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if !done {
+		t.Fatal("response not complete")
+	}
+	want := GamepadMap{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x00, 0x00, 0x00}
+	if len(p.maps) != 2 || p.maps[0] != want || p.maps[1] != want {
+		t.Errorf("got maps %v, want 2 times %v", p.maps, want)
+	}
+}
+
+func TestDownloadParserMalformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		mapCount int
+		err      error
+		line     string
+		offset   int
+	}{
+		{
+			name:     "short line",
+			response: "START\r\n01 02 04\r\nEND\r\n",
+			mapCount: 1,
+			err:      ErrWrongButtonCount,
+			line:     "01 02 04",
+			offset:   7,
+		},
+		{
+			name:     "long line",
+			response: "START\n" + testMapLine + " 00\nEND\n",
+			mapCount: 1,
+			err:      ErrWrongButtonCount,
+			line:     testMapLine + " 00",
+			offset:   6,
+		},
+		{
+			name:     "bad hex",
+			response: "START\n01 02 04 08 10 2G 40 00 00 00\nEND\n",
+			mapCount: 1,
+			err:      ErrMalformedLine,
+			line:     "01 02 04 08 10 2G 40 00 00 00",
+			offset:   6,
+		},
+		{
+			name:     "value out of range",
+			response: "START\n01 02 04 08 10 20 40 00 00 100\nEND\n",
+			mapCount: 1,
+			err:      ErrMalformedLine,
+			line:     "01 02 04 08 10 20 40 00 00 100",
+			offset:   6,
+		},
+		{
+			name:     "too few maps",
+			response: "START\n" + testMapLine + "\nEND\n",
+			mapCount: 2,
+			err:      ErrUnexpectedMapCount,
+			line:     "END",
+			offset:   6 + len(testMapLine) + 1,
+		},
+		{
+			name:     "too many maps",
+			response: "START\n" + testMapLine + "\n" + testMapLine + "\nEND\r\n",
+			mapCount: 1,
+			err:      ErrUnexpectedMapCount,
+			line:     "END",
+			offset:   6 + 2*(len(testMapLine)+1),
+		},
+		{
+			name:     "default map count",
+			response: "START\n" + testMapLine + "\nEND\n",
+			err:      ErrUnexpectedMapCount,
+			line:     "END",
+			offset:   6 + len(testMapLine) + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := downloadParser{mapCount: tt.mapCount}
+			done, err := p.Write([]byte(tt.response))
+			if done {
+				t.Error("malformed response reported as complete")
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("got %T, want *ParseError", err)
+			}
+			if parseErr.Line != tt.line {
+				t.Errorf("got line %q, want %q", parseErr.Line, tt.line)
+			}
+			if parseErr.Offset != tt.offset {
+				t.Errorf("got offset %d, want %d", parseErr.Offset, tt.offset)
+			}
+		})
+	}
+}
+
+// TestDownloadParserMissingTerminator checks that a response without END is
+// never complete, so the download waits for more data until it times out.
+func TestDownloadParserMissingTerminator(t *testing.T) {
+	for _, response := range []string{
+		"",
+		"noise without start\n" + testMapLine + "\nEND\n",
+		"START\n" + testMapLine + "\n",
+		"START\n" + testMapLine + "\nEN",
+	} {
+		p := downloadParser{mapCount: 1}
+		done, err := p.Write([]byte(response))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", response, err)
+		}
+		if done {
+			t.Errorf("%q: reported as complete", response)
+		}
+	}
+}
+
+func TestParseFramedMaps(t *testing.T) {
+	payload := []byte(strings.Repeat("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a", 2))
+
+	maps, err := parseFramedMaps(payload, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) != 2 || maps[1] != (GamepadMap{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}) {
+		t.Errorf("got %v", maps)
+	}
+
+	var parseErr *ParseError
+	if _, err := parseFramedMaps(payload[:15], 2); !errors.As(err, &parseErr) || !errors.Is(err, ErrUnexpectedMapCount) {
+		t.Errorf("got %v, want a *ParseError wrapping %v", err, ErrUnexpectedMapCount)
+	}
+}
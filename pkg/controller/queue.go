@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrClosed = errors.New("controller closed")
+
+// request is an operation waiting for its turn on the wire.
+type request struct {
+	ctx  context.Context
+	fn   func(context.Context) (interface{}, error)
+	done chan result
+}
+
+// result is the outcome of a request. It is handed over on the done channel
+// only, as the submitter may have given up on the request while fn runs.
+type result struct {
+	value interface{}
+	err   error
+}
+
+// submit queues fn behind the operations submitted before and waits for the
+// value it returns. Operations never overlap on the wire, whichever goroutine
+// submits them. fn must not write to variables of the submitter, which may
+// return before fn does when ctx ends.
+func (c *Controller) submit(ctx context.Context, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	req := &request{
+		ctx:  ctx,
+		fn:   fn,
+		done: make(chan result, 1),
+	}
+
+	select {
+	case c.queue <- req:
+	case <-c.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctxError(ctx, "wait for queued operations")
+	}
+
+	select {
+	case r := <-req.done:
+		return r.value, r.err
+	case <-ctx.Done():
+		// fn watches the same context and ends soon
+		return nil, ctxError(ctx, "operation")
+	}
+}
+
+func (c *Controller) run() {
+	for {
+		select {
+		case req := <-c.queue:
+			req.done <- c.exec(req)
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *Controller) exec(req *request) result {
+	select {
+	case <-c.closed:
+		return result{err: ErrClosed}
+	default:
+	}
+
+	if req.ctx.Err() != nil {
+		return result{err: ctxError(req.ctx, "wait for queued operations")}
+	}
+
+	value, err := req.fn(req.ctx)
+
+	// the operation was cut off by Close
+	select {
+	case <-c.closed:
+		if err != nil {
+			return result{err: ErrClosed}
+		}
+	default:
+	}
+
+	return result{value: value, err: err}
+}
@@ -0,0 +1,71 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/emulator"
+)
+
+// slowReader delays every read while slow is set, so operations outlast the
+// context of their caller.
+type slowReader struct {
+	io.ReadWriteCloser
+	slow *atomic.Bool
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	if r.slow.Load() {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return r.ReadWriteCloser.Read(p)
+}
+
+// TestSubmitCancelled abandons operations while they run on the queue, which
+// the race detector checks for writes to the results of the caller.
+func TestSubmitCancelled(t *testing.T) {
+	e, err := emulator.New(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var slow atomic.Bool
+	controller.RegisterOpener("slow", func(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+		return slowReader{e.Pipe(), &slow}, nil
+	})
+
+	c, err := controller.OpenWithOptions(context.Background(), "slow://emulator", controller.ControllerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	slow.Store(true)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		maps, err := c.DownloadContext(ctx)
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+		if maps != nil {
+			t.Errorf("got maps %v along with an error", maps)
+		}
+	}
+	slow.Store(false)
+
+	maps, err := c.DownloadContext(context.Background())
+	if err != nil {
+		t.Fatalf("failed to download after cancelled operations: %v", err)
+	}
+	if len(maps) != controller.MapCount {
+		t.Errorf("got %d maps, want %d", len(maps), controller.MapCount)
+	}
+}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+type ConnectionState int
+
+const (
+	StateConnected ConnectionState = iota
+	StateReconnecting
+	StateDisconnected
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// ReconnectPolicy controls how a Controller reopens a broken link.
+type ReconnectPolicy struct {
+	// InitialBackoff is the delay before the second attempt, doubling with
+	// every further attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxAttempts limits the attempts per broken link, 0 retries until the
+	// context of the interrupted operation ends.
+	MaxAttempts int
+	// MaxReplays limits how often an interrupted operation is replayed.
+	MaxReplays int
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	MaxAttempts:    10,
+	MaxReplays:     3,
+}
+
+type ControllerOptions struct {
+	// Timeouts bound the operations, DefaultTimeouts if nil.
+	Timeouts *Timeouts
+
+	// Reconnect enables reopening the target when the link breaks, e.g.
+	// because the cable was pulled. Interrupted idempotent operations are
+	// replayed on the new link. Nil disables reconnecting.
+	Reconnect *ReconnectPolicy
+
+	// OnStateChange is called whenever the connection state changes.
+	OnStateChange func(ConnectionState)
+
+	// Serial configures serial ports, DefaultSerialSettings if nil. It is
+	// ignored by other transports.
+	Serial *SerialSettings
+
+	// Reset selects whether connecting reboots the adapter, ResetAuto if
+	// empty. BannerWindow is the time ResetAuto waits for the boot banner,
+	// DefaultBannerWindow if zero.
+	Reset        ResetMode
+	BannerWindow time.Duration
+
+	// Protocol selects the protocol of the operations, ProtocolAuto if
+	// empty.
+	Protocol Protocol
+
+	// Trace receives every byte sent and received, as JSON lines of
+	// TraceEvent. The trace can be played back with NewReplay.
+	Trace io.Writer
+}
+
+// OpenWithOptions is OpenContext with additional options.
+// The target AutoTarget keeps the connection that detected the adapter.
+func OpenWithOptions(ctx context.Context, target string, opts ControllerOptions) (*Controller, error) {
+	if target == AutoTarget {
+		c, _, err := openAuto(ctx, DiscoverOptions{}, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect adapter: %w", err)
+		}
+
+		return c, nil
+	}
+
+	t, err := openTransport(ctx, target, opts.serialSettings())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newController(ctx, t, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.reopen = func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return openTransport(ctx, target, opts.serialSettings())
+	}
+
+	return c, nil
+}
+
+// State returns the current connection state.
+func (c *Controller) State() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+func (c *Controller) setState(s ConnectionState) {
+	c.mu.Lock()
+	changed := c.state != s
+	c.state = s
+	c.mu.Unlock()
+
+	if changed && c.opts.OnStateChange != nil {
+		c.opts.OnStateChange(s)
+	}
+}
+
+func (c *Controller) currentConn() *conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn
+}
+
+// do runs fn on the current connection. If the link breaks and reconnecting
+// is enabled, it reconnects and, for idempotent operations, runs fn again.
+func (c *Controller) do(ctx context.Context, idempotent bool, fn func(*conn) error) error {
+	replays := 0
+
+	for {
+		err := fn(c.currentConn())
+		if err == nil || c.opts.Reconnect == nil || c.reopen == nil || !isBrokenLink(err) {
+			return err
+		}
+
+		if rerr := c.reconnect(ctx); rerr != nil {
+			return fmt.Errorf("%w; failed to reconnect: %v", err, rerr)
+		}
+
+		if !idempotent || replays >= c.opts.Reconnect.MaxReplays {
+			return err
+		}
+		replays++
+	}
+}
+
+func (c *Controller) reconnect(ctx context.Context) error {
+	policy := c.opts.Reconnect
+
+	c.setState(StateReconnecting)
+	c.currentConn().close()
+
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.reconnectOnce(ctx)
+		if err == nil {
+			c.setState(StateConnected)
+			return nil
+		}
+
+		if errors.Is(err, ErrClosed) || (policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts) {
+			c.setState(StateDisconnected)
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-c.closed:
+			return ErrClosed
+		case <-ctx.Done():
+			c.setState(StateDisconnected)
+			return ctxError(ctx, "reconnect")
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+func (c *Controller) reconnectOnce(ctx context.Context) error {
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+
+	ctx, cancel := withTimeout(ctx, c.Timeouts().Connect)
+	defer cancel()
+
+	t, err := c.reopen(ctx)
+	if err != nil {
+		return err
+	}
+	if c.tracer != nil {
+		t = c.tracer.Wrap(t)
+	}
+
+	conn := newConn(t)
+	if err := c.handshake(ctx, conn); err != nil {
+		conn.close()
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Close may have been called while the adapter was booting
+	select {
+	case <-c.closed:
+		conn.close()
+		return ErrClosed
+	default:
+	}
+
+	c.conn = conn
+
+	return nil
+}
+
+// isBrokenLink reports whether err means that the transport is gone, as
+// opposed to the adapter misbehaving on a working link.
+func isBrokenLink(err error) bool {
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, os.ErrClosed) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.ENXIO)
+}
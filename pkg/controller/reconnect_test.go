@@ -0,0 +1,170 @@
+package controller_test
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/emulator"
+)
+
+// memAdapter serves an emulator as mem:// device that can be unplugged and
+// plugged in again.
+type memAdapter struct {
+	t    *testing.T
+	e    *emulator.Emulator
+	name string
+
+	mu     sync.Mutex
+	device io.ReadWriteCloser
+	opens  int
+	states []controller.ConnectionState
+}
+
+func newMemAdapter(t *testing.T) *memAdapter {
+	e, err := emulator.New(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &memAdapter{t: t, e: e, name: t.Name()}
+	a.plug()
+	t.Cleanup(func() { controller.UnregisterMemDevice(a.name) })
+
+	return a
+}
+
+func (a *memAdapter) plug() {
+	controller.RegisterMemDevice(a.name, func(device io.ReadWriteCloser) {
+		a.mu.Lock()
+		a.device = device
+		a.opens++
+		a.mu.Unlock()
+
+		defer device.Close()
+		_ = a.e.Serve(device)
+	})
+}
+
+// unplug breaks the open connection, and opening fails until plug.
+func (a *memAdapter) unplug() {
+	controller.UnregisterMemDevice(a.name)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.device.Close()
+}
+
+func (a *memAdapter) onStateChange(state controller.ConnectionState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.states = append(a.states, state)
+}
+
+func (a *memAdapter) result() (int, []controller.ConnectionState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.opens, append([]controller.ConnectionState(nil), a.states...)
+}
+
+func (a *memAdapter) open(policy controller.ReconnectPolicy) *controller.Controller {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := controller.OpenWithOptions(ctx, "mem://"+a.name, controller.ControllerOptions{
+		Reconnect:     &policy,
+		OnStateChange: a.onStateChange,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	a.t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestReconnect(t *testing.T) {
+	a := newMemAdapter(t)
+	c := a.open(controller.ReconnectPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		MaxAttempts:    20,
+		MaxReplays:     1,
+	})
+
+	want := controller.GamepadMap{0x01, 0x02, 0x04, 0x08, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00}
+	if err := a.e.SetMap(2, want); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the download is sent while the adapter is unplugged, and it returns
+	// after a few attempts to reopen it
+	a.unplug()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		a.plug()
+	}()
+
+	maps, err := c.DownloadContext(ctx)
+	if err != nil {
+		t.Fatalf("interrupted download failed: %v", err)
+	}
+	if maps[2] != want {
+		t.Errorf("got map %s, want %s", maps[2].Hex(), want.Hex())
+	}
+
+	opens, states := a.result()
+	if opens != 2 {
+		t.Errorf("opened the adapter %d times, want 2", opens)
+	}
+	if want := []controller.ConnectionState{controller.StateReconnecting, controller.StateConnected}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+	if got := c.State(); got != controller.StateConnected {
+		t.Errorf("got state %v, want %v", got, controller.StateConnected)
+	}
+
+	// the new connection serves further commands
+	if err := c.UploadContext(ctx, 3, want); err != nil {
+		t.Fatalf("failed to upload after reconnecting: %v", err)
+	}
+	if got := a.e.Maps()[3]; got != want {
+		t.Errorf("got map %s after upload, want %s", got.Hex(), want.Hex())
+	}
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+	a := newMemAdapter(t)
+	c := a.open(controller.ReconnectPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxAttempts:    3,
+		MaxReplays:     1,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.unplug()
+	if _, err := c.DownloadContext(ctx); err == nil {
+		t.Fatal("download succeeded without an adapter")
+	}
+
+	opens, states := a.result()
+	if opens != 1 {
+		t.Errorf("opened the adapter %d times, want 1", opens)
+	}
+	if want := []controller.ConnectionState{controller.StateReconnecting, controller.StateDisconnected}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResetMode controls whether connecting reboots the adapter.
+type ResetMode string
+
+const (
+	// ResetAuto lets opening the port reset the adapter, as the DTR line of
+	// Arduino based adapters does, and waits for the boot banner. Adapters
+	// that do not print one within the banner window are asked for their
+	// version instead.
+	ResetAuto ResetMode = "auto"
+	// ResetNone holds DTR low, so connecting does not reboot the adapter,
+	// e.g. in the middle of a game, and asks the running adapter for its
+	// version. Some drivers raise DTR for a moment while opening the port
+	// anyway; on Linux, disabling HUPCL with "stty -hupcl" avoids that.
+	ResetNone ResetMode = "none"
+)
+
+// DefaultBannerWindow is the time ResetAuto waits for the boot banner.
+const DefaultBannerWindow = 3 * time.Second
+
+// ParseResetMode parses "auto" or "none".
+func ParseResetMode(s string) (ResetMode, error) {
+	switch m := ResetMode(s); m {
+	case ResetAuto, ResetNone:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid reset mode %q", s)
+	}
+}
+
+// serialSettings returns the serial settings to open ports with in the reset
+// mode of opts.
+func (opts ControllerOptions) serialSettings() *SerialSettings {
+	if opts.Reset != ResetNone {
+		return opts.Serial
+	}
+
+	var settings SerialSettings
+	if opts.Serial != nil {
+		settings = *opts.Serial
+	}
+	settings.DTR = LineOff
+
+	return &settings
+}
+
+// handshake waits until the adapter behind conn is ready.
+func (c *Controller) handshake(ctx context.Context, conn *conn) error {
+	if c.opts.Reset != ResetNone {
+		window := c.opts.BannerWindow
+		if window == 0 {
+			window = DefaultBannerWindow
+		}
+
+		wctx, cancel := withTimeout(ctx, window)
+		_, err := conn.readUntil(wctx, "connect", SetupCompleteMsg)
+		cancel()
+
+		if err == nil || !errors.Is(err, ErrTimeout) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	// the adapter did not reset and is running already
+	ctx, cancel := withTimeout(ctx, c.Timeouts().Version)
+	defer cancel()
+
+	conn.discard()
+
+	if err := conn.write(ctx, "connect", []byte(FirmwareVersionCmd)); err != nil {
+		return err
+	}
+
+	// a slow adapter may still finish booting instead of answering
+	var content strings.Builder
+
+	return conn.readFunc(ctx, "connect", func(b []byte) (bool, error) {
+		content.Write(b)
+		return strings.Contains(content.String(), FirmwareVersionCompleteMsg) || strings.Contains(content.String(), SetupCompleteMsg), nil
+	})
+}
@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// SchemeRFC2217 targets, "rfc2217://host:port", are serial ports shared over
+// telnet with the RFC 2217 com port option, which carries the serial
+// settings and the DTR and RTS lines to the remote port. "tcp://host:port"
+// targets are raw sockets that use the settings of the remote end.
+const SchemeRFC2217 = "rfc2217"
+
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetBinary  = 0
+	telnetComPort = 44
+
+	comSetBaudRate = 1
+	comSetDataSize = 2
+	comSetParity   = 3
+	comSetStopSize = 4
+	comSetControl  = 5
+	// the server answers a command with its code plus comServerOffset
+	comServerOffset = 100
+
+	comDTROn  = 8
+	comDTROff = 9
+	comRTSOn  = 11
+	comRTSOff = 12
+)
+
+var (
+	comParities = map[Parity]byte{
+		ParityNone:  1,
+		ParityOdd:   2,
+		ParityEven:  3,
+		ParityMark:  4,
+		ParitySpace: 5,
+	}
+	comStopBits = map[StopBits]byte{
+		StopBits1:   1,
+		StopBits2:   2,
+		StopBits1_5: 3,
+	}
+)
+
+func init() {
+	RegisterOpener(SchemeRFC2217, func(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+		return DialRFC2217(ctx, address, SerialSettings{})
+	})
+}
+
+// telnetDecoder removes telnet commands from a received stream and passes
+// them to its callbacks.
+type telnetDecoder struct {
+	// onCommand receives WILL, WONT, DO and DONT with their option.
+	onCommand func(cmd, option byte)
+	// onSub receives subnegotiations without IAC SB and IAC SE.
+	onSub func(sub []byte)
+
+	state int
+	cmd   byte
+	sub   []byte
+}
+
+const (
+	telnetData = iota
+	telnetCommand
+	telnetOption
+	telnetSub
+	telnetSubIAC
+)
+
+// decode returns the data in p, reusing p.
+func (d *telnetDecoder) decode(p []byte) []byte {
+	data := p[:0]
+
+	for _, b := range p {
+		switch d.state {
+		case telnetData:
+			if b == telnetIAC {
+				d.state = telnetCommand
+			} else {
+				data = append(data, b)
+			}
+		case telnetCommand:
+			switch b {
+			case telnetIAC:
+				data = append(data, b)
+				d.state = telnetData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				d.cmd = b
+				d.state = telnetOption
+			case telnetSB:
+				d.sub = d.sub[:0]
+				d.state = telnetSub
+			default:
+				// NOP, break and the like have no meaning for a serial line
+				d.state = telnetData
+			}
+		case telnetOption:
+			if d.onCommand != nil {
+				d.onCommand(d.cmd, b)
+			}
+			d.state = telnetData
+		case telnetSub:
+			if b == telnetIAC {
+				d.state = telnetSubIAC
+			} else {
+				d.sub = append(d.sub, b)
+			}
+		case telnetSubIAC:
+			switch b {
+			case telnetSE:
+				if d.onSub != nil {
+					d.onSub(append([]byte(nil), d.sub...))
+				}
+				d.state = telnetData
+			default:
+				d.sub = append(d.sub, b)
+				d.state = telnetSub
+			}
+		}
+	}
+
+	return data
+}
+
+// escapeIAC doubles the IAC bytes of data.
+func escapeIAC(data []byte) []byte {
+	escaped := make([]byte, 0, len(data))
+	for _, b := range data {
+		escaped = append(escaped, b)
+		if b == telnetIAC {
+			escaped = append(escaped, telnetIAC)
+		}
+	}
+
+	return escaped
+}
+
+func comPortSub(cmd byte, value []byte) []byte {
+	b := []byte{telnetIAC, telnetSB, telnetComPort, cmd}
+	b = append(b, escapeIAC(value)...)
+
+	return append(b, telnetIAC, telnetSE)
+}
+
+// comPortSubs encodes the fields of s that are set as com port commands.
+func comPortSubs(s SerialSettings) ([]byte, error) {
+	var b []byte
+
+	if s.BaudRate > 0 {
+		b = append(b, comPortSub(comSetBaudRate, binary.BigEndian.AppendUint32(nil, uint32(s.BaudRate)))...)
+	}
+	if s.DataBits != 0 {
+		b = append(b, comPortSub(comSetDataSize, []byte{byte(s.DataBits)})...)
+	}
+	if s.Parity != "" {
+		v, ok := comParities[s.Parity]
+		if !ok {
+			return nil, fmt.Errorf("invalid parity %q", s.Parity)
+		}
+		b = append(b, comPortSub(comSetParity, []byte{v})...)
+	}
+	if s.StopBits != "" {
+		v, ok := comStopBits[s.StopBits]
+		if !ok {
+			return nil, fmt.Errorf("invalid stop bits %q", s.StopBits)
+		}
+		b = append(b, comPortSub(comSetStopSize, []byte{v})...)
+	}
+	switch s.DTR {
+	case LineOn:
+		b = append(b, comPortSub(comSetControl, []byte{comDTROn})...)
+	case LineOff:
+		b = append(b, comPortSub(comSetControl, []byte{comDTROff})...)
+	}
+	switch s.RTS {
+	case LineOn:
+		b = append(b, comPortSub(comSetControl, []byte{comRTSOn})...)
+	case LineOff:
+		b = append(b, comPortSub(comSetControl, []byte{comRTSOff})...)
+	}
+
+	return b, nil
+}
+
+// rfc2217Conn is the client end of an RFC 2217 connection.
+type rfc2217Conn struct {
+	net.Conn
+
+	dec telnetDecoder
+
+	writeMu sync.Mutex
+}
+
+// DialRFC2217 connects to the RFC 2217 server at address and asks it to open
+// the port with the fields of settings that are set. The remote port keeps
+// its own settings for the others. AutoBaud is not available remotely.
+func DialRFC2217(ctx context.Context, address string, settings SerialSettings) (io.ReadWriteCloser, error) {
+	if settings.BaudRate == AutoBaud {
+		return nil, fmt.Errorf("automatic baud rate detection is not available over %s", SchemeRFC2217)
+	}
+
+	subs, err := comPortSubs(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &rfc2217Conn{Conn: nc}
+	c.dec.onCommand = c.handleCommand
+
+	b := []byte{
+		telnetIAC, telnetWILL, telnetBinary,
+		telnetIAC, telnetDO, telnetBinary,
+		telnetIAC, telnetWILL, telnetComPort,
+	}
+	if err := c.writeRaw(append(b, subs...)); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to negotiate com port option: %w", err)
+	}
+
+	return c, nil
+}
+
+// handleCommand refuses the options the client did not ask for.
+func (c *rfc2217Conn) handleCommand(cmd, option byte) {
+	if option == telnetBinary || option == telnetComPort {
+		return
+	}
+
+	switch cmd {
+	case telnetDO:
+		_ = c.writeRaw([]byte{telnetIAC, telnetWONT, option})
+	case telnetWILL:
+		_ = c.writeRaw([]byte{telnetIAC, telnetDONT, option})
+	}
+}
+
+func (c *rfc2217Conn) writeRaw(b []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err := c.Conn.Write(b)
+
+	return err
+}
+
+func (c *rfc2217Conn) Read(p []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(p)
+		data := c.dec.decode(p[:n])
+		if len(data) > 0 || err != nil {
+			return len(data), err
+		}
+	}
+}
+
+func (c *rfc2217Conn) Write(p []byte) (int, error) {
+	if err := c.writeRaw(escapeIAC(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// AutoBaud as SerialSettings.BaudRate tries CommonBaudRates until the adapter
+// answers.
+const AutoBaud = -1
+
+// CommonBaudRates are tried by DetectBaudRate, in this order.
+var CommonBaudRates = []int{9600, 115200, 57600, 38400, 19200, 4800}
+
+// AutoBaudTimeout bounds the wait for the banner at a single baud rate.
+const AutoBaudTimeout = 2 * time.Second
+
+var ErrBaudRateNotFound = errors.New("no baud rate found")
+
+type Parity string
+
+const (
+	ParityNone  Parity = "none"
+	ParityOdd   Parity = "odd"
+	ParityEven  Parity = "even"
+	ParityMark  Parity = "mark"
+	ParitySpace Parity = "space"
+)
+
+type StopBits string
+
+const (
+	StopBits1   StopBits = "1"
+	StopBits1_5 StopBits = "1.5"
+	StopBits2   StopBits = "2"
+)
+
+// LineState is the state the DTR and RTS lines are set to when the port is
+// opened.
+type LineState string
+
+const (
+	LineOn  LineState = "on"
+	LineOff LineState = "off"
+)
+
+// SerialSettings configure the serial line. Zero fields use the defaults of
+// DefaultSerialSettings.
+type SerialSettings struct {
+	BaudRate int
+	DataBits int
+	Parity   Parity
+	StopBits StopBits
+	DTR      LineState
+	RTS      LineState
+}
+
+var DefaultSerialSettings = SerialSettings{
+	BaudRate: 9600,
+	DataBits: 8,
+	Parity:   ParityNone,
+	StopBits: StopBits1,
+	DTR:      LineOn,
+	RTS:      LineOn,
+}
+
+func (s SerialSettings) withDefaults() SerialSettings {
+	d := DefaultSerialSettings
+
+	if s.BaudRate == 0 {
+		s.BaudRate = d.BaudRate
+	}
+	if s.DataBits == 0 {
+		s.DataBits = d.DataBits
+	}
+	if s.Parity == "" {
+		s.Parity = d.Parity
+	}
+	if s.StopBits == "" {
+		s.StopBits = d.StopBits
+	}
+	if s.DTR == "" {
+		s.DTR = d.DTR
+	}
+	if s.RTS == "" {
+		s.RTS = d.RTS
+	}
+
+	return s
+}
+
+func (s SerialSettings) mode() (*serial.Mode, error) {
+	s = s.withDefaults()
+
+	m := &serial.Mode{
+		BaudRate: s.BaudRate,
+		DataBits: s.DataBits,
+	}
+
+	if s.BaudRate <= 0 {
+		return nil, fmt.Errorf("invalid baud rate %d", s.BaudRate)
+	}
+	if s.DataBits < 5 || s.DataBits > 8 {
+		return nil, fmt.Errorf("invalid data bits %d", s.DataBits)
+	}
+
+	switch s.Parity {
+	case ParityNone:
+		m.Parity = serial.NoParity
+	case ParityOdd:
+		m.Parity = serial.OddParity
+	case ParityEven:
+		m.Parity = serial.EvenParity
+	case ParityMark:
+		m.Parity = serial.MarkParity
+	case ParitySpace:
+		m.Parity = serial.SpaceParity
+	default:
+		return nil, fmt.Errorf("invalid parity %q", s.Parity)
+	}
+
+	switch s.StopBits {
+	case StopBits1:
+		m.StopBits = serial.OneStopBit
+	case StopBits1_5:
+		m.StopBits = serial.OnePointFiveStopBits
+	case StopBits2:
+		m.StopBits = serial.TwoStopBits
+	default:
+		return nil, fmt.Errorf("invalid stop bits %q", s.StopBits)
+	}
+
+	if s.DTR != LineOn && s.DTR != LineOff {
+		return nil, fmt.Errorf("invalid DTR state %q", s.DTR)
+	}
+	if s.RTS != LineOn && s.RTS != LineOff {
+		return nil, fmt.Errorf("invalid RTS state %q", s.RTS)
+	}
+
+	return m, nil
+}
+
+// openPort opens the serial port name and sets its modem lines. Both lines
+// are on by default. Ports without modem lines, like ptys, cannot set them,
+// which only means that the adapter may reset, so it is not an error.
+func openPort(name string, settings SerialSettings) (serial.Port, error) {
+	mode, err := settings.mode()
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := serial.Open(name, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	settings = settings.withDefaults()
+	if settings.DTR == LineOff || settings.RTS == LineOff {
+		err := port.SetDTR(settings.DTR == LineOn)
+		if err == nil {
+			err = port.SetRTS(settings.RTS == LineOn)
+		}
+		if err != nil {
+			log.Printf("warning: failed to set the modem lines of %s, the adapter may reset: %v", name, err)
+		}
+	}
+
+	return port, nil
+}
+
+// ParseBaudRate parses a baud rate or "auto" for AutoBaud.
+func ParseBaudRate(s string) (int, error) {
+	if strings.EqualFold(s, "auto") {
+		return AutoBaud, nil
+	}
+
+	rate, err := strconv.Atoi(s)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid baud rate %q", s)
+	}
+
+	return rate, nil
+}
+
+// OpenSerial opens the serial port name with the given settings. With
+// AutoBaud, the returned port delivers the banner seen while detecting the
+// baud rate again.
+func OpenSerial(ctx context.Context, name string, settings SerialSettings) (io.ReadWriteCloser, error) {
+	if settings.BaudRate == AutoBaud {
+		_, port, err := detectBaudRate(ctx, name, settings, CommonBaudRates)
+		return port, err
+	}
+
+	return openPort(name, settings)
+}
+
+// DetectBaudRate opens the serial port name at each of rates until the
+// adapter prints SetupCompleteMsg. Opening the port resets most adapters, so
+// every attempt waits for a fresh banner.
+func DetectBaudRate(ctx context.Context, name string, settings SerialSettings, rates []int) (int, error) {
+	rate, port, err := detectBaudRate(ctx, name, settings, rates)
+	if err != nil {
+		return 0, err
+	}
+	port.Close()
+
+	return rate, nil
+}
+
+func detectBaudRate(ctx context.Context, name string, settings SerialSettings, rates []int) (int, io.ReadWriteCloser, error) {
+	for _, rate := range rates {
+		settings.BaudRate = rate
+
+		port, err := openPort(name, settings)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		banner, err := readBanner(ctx, port)
+		if err == nil {
+			return rate, &prefixedPort{ReadWriteCloser: port, prefix: banner}, nil
+		}
+		port.Close()
+
+		if ctx.Err() != nil {
+			return 0, nil, ctxError(ctx, "detect baud rate")
+		}
+	}
+
+	return 0, nil, fmt.Errorf("%w for %s, tried %v", ErrBaudRateNotFound, name, rates)
+}
+
+// readBanner reads from port until SetupCompleteMsg was received, at most for
+// AutoBaudTimeout.
+func readBanner(ctx context.Context, port serial.Port) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, AutoBaudTimeout)
+	defer cancel()
+
+	if err := port.SetReadTimeout(100 * time.Millisecond); err != nil {
+		return nil, err
+	}
+	defer port.SetReadTimeout(serial.NoTimeout)
+
+	var received []byte
+	buf := make([]byte, 64)
+	for ctx.Err() == nil {
+		n, err := port.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		received = append(received, buf[:n]...)
+		if strings.Contains(string(received), SetupCompleteMsg) {
+			return received, nil
+		}
+	}
+
+	return nil, ctxError(ctx, "wait for banner")
+}
+
+// prefixedPort returns prefix before reading from the port.
+type prefixedPort struct {
+	io.ReadWriteCloser
+	prefix []byte
+}
+
+func (p *prefixedPort) Read(b []byte) (int, error) {
+	if len(p.prefix) > 0 {
+		n := copy(b, p.prefix)
+		p.prefix = p.prefix[n:]
+		return n, nil
+	}
+
+	return p.ReadWriteCloser.Read(b)
+}
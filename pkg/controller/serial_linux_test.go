@@ -0,0 +1,65 @@
+package controller_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/emulator"
+)
+
+// openPTY returns the master and the path of the slave side of a new
+// pseudo-terminal, a serial port without modem lines.
+func openPTY(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatalf("failed to unlock pty: %v", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatalf("failed to get pty number: %v", err)
+	}
+
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+// TestOpenResetNonePTY opens a pty, which cannot hold DTR low, without
+// resetting the adapter.
+func TestOpenResetNonePTY(t *testing.T) {
+	master, slave := openPTY(t)
+
+	e, err := emulator.New(emulator.Options{NoReset: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go e.Serve(master)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := controller.OpenWithOptions(ctx, "serial://"+slave, controller.ControllerOptions{Reset: controller.ResetNone})
+	if err != nil {
+		t.Fatalf("failed to open %s without reset: %v", slave, err)
+	}
+	defer c.Close()
+
+	maps, err := c.DownloadContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to download: %v", err)
+	}
+	if len(maps) != controller.MapCount {
+		t.Errorf("got %d maps, want %d", len(maps), controller.MapCount)
+	}
+}
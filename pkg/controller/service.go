@@ -1,12 +1,11 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
-
-	"go.bug.st/serial"
+	"sync"
 )
 
 const (
@@ -18,34 +17,141 @@ const (
 
 	UploadCmd     = "u"
 	UploadDoneMsg = "Done"
+	// ErrorMsg starts the line of a rejected command, followed by the
+	// reason.
+	ErrorMsg = "Error:"
 
 	FirmwareVersionCmd         = "v"
 	FirmwareVersionCompleteMsg = "VERSION_END"
 )
 
-type GamepadMap [10]uint8
+const (
+	MapCount    = 8
+	ButtonCount = 10
+)
+
+type GamepadMap [ButtonCount]uint8
 
 type Controller struct {
-	port io.ReadWriteCloser
+	opts ControllerOptions
+
+	// reopen opens the transport again after the link broke. It is nil if
+	// the Controller was created from a transport.
+	reopen func(context.Context) (io.ReadWriteCloser, error)
+	tracer *Tracer
+	closed chan struct{}
+
+	// queue hands operations to the goroutine that runs them one at a time.
+	// Only that goroutine uses info and the connection.
+	queue chan *request
+
+	mu       sync.Mutex
+	conn     *conn
+	state    ConnectionState
+	timeouts Timeouts
+
+	// info caches the firmware info once it has been queried. framed is
+	// set if the operations use the framed protocol.
+	info   *FirmwareInfo
+	framed bool
 }
 
+// NewController opens the serial port p and waits for the adapter to boot.
 func NewController(p string) (*Controller, error) {
-	port, err := serial.Open(p, &serial.Mode{})
+	ctx, cancel := withTimeout(context.Background(), DefaultTimeouts.Connect)
+	defer cancel()
+
+	return NewControllerContext(ctx, p)
+}
+
+func NewControllerContext(ctx context.Context, p string) (*Controller, error) {
+	port, err := openSerial(ctx, p)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open port: %w", err)
 	}
 
-	if _, err := readUntil(port, SetupCompleteMsg); err != nil {
-		return nil, fmt.Errorf("failed to read from port: %w", err)
+	return NewControllerFromTransportContext(ctx, port)
+}
+
+// NewControllerFromTransport waits for the adapter behind port to boot and
+// returns a Controller speaking to it. The Controller owns port and closes it
+// on Close, also when the adapter never becomes ready.
+func NewControllerFromTransport(port io.ReadWriteCloser) (*Controller, error) {
+	ctx, cancel := withTimeout(context.Background(), DefaultTimeouts.Connect)
+	defer cancel()
+
+	return NewControllerFromTransportContext(ctx, port)
+}
+
+// NewControllerFromTransportContext is NewControllerFromTransport bounded by
+// ctx instead of DefaultTimeouts.Connect.
+func NewControllerFromTransportContext(ctx context.Context, port io.ReadWriteCloser) (*Controller, error) {
+	return newController(ctx, port, ControllerOptions{})
+}
+
+func newController(ctx context.Context, port io.ReadWriteCloser, opts ControllerOptions) (*Controller, error) {
+	var tracer *Tracer
+	if opts.Trace != nil {
+		tracer = NewTracer(opts.Trace)
+		port = tracer.Wrap(port)
+	}
+
+	c := &Controller{
+		opts:     opts,
+		tracer:   tracer,
+		closed:   make(chan struct{}),
+		queue:    make(chan *request),
+		conn:     newConn(port),
+		state:    StateConnected,
+		timeouts: DefaultTimeouts,
+	}
+	if opts.Timeouts != nil {
+		c.timeouts = *opts.Timeouts
+	}
+
+	if err := c.handshake(ctx, c.conn); err != nil {
+		c.conn.close()
+		return nil, err
 	}
 
-	return &Controller{
-		port,
-	}, nil
+	go c.run()
+
+	return c, nil
+}
+
+// Timeouts returns the timeouts of the operations.
+func (c *Controller) Timeouts() Timeouts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.timeouts
 }
 
+// SetTimeouts changes the timeouts of operations started afterwards.
+func (c *Controller) SetTimeouts(t Timeouts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timeouts = t
+}
+
+// Close closes the connection. Operations still waiting in the queue fail
+// with ErrClosed.
 func (c *Controller) Close() error {
-	if err := c.port.Close(); err != nil {
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return nil
+	default:
+		close(c.closed)
+	}
+	conn := c.conn
+	c.mu.Unlock()
+
+	defer c.setState(StateClosed)
+
+	if err := conn.close(); err != nil {
 		return fmt.Errorf("failed to close port: %w", err)
 	}
 
@@ -53,94 +159,223 @@ func (c *Controller) Close() error {
 }
 
 func (c *Controller) GetFirmwareVersion() (string, error) {
-	if _, err := c.port.Write([]byte("v")); err != nil {
-		return "", fmt.Errorf("failed to write to port: %w", err)
-	}
+	return c.GetFirmwareVersionContext(context.Background())
+}
 
-	m, err := readUntil(c.port, FirmwareVersionCompleteMsg)
+func (c *Controller) GetFirmwareVersionContext(ctx context.Context) (string, error) {
+	v, err := c.submit(ctx, func(ctx context.Context) (interface{}, error) {
+		return c.firmwareVersion(ctx)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read from port: %w", err)
+		return "", err
 	}
 
-	return m[:len(m)-len(FirmwareVersionCompleteMsg)-3], nil
+	return v.(string), nil
+}
+
+// FirmwareInfo queries and parses the firmware version. The result is
+// cached and used to check the arguments of later operations.
+func (c *Controller) FirmwareInfo() (FirmwareInfo, error) {
+	return c.FirmwareInfoContext(context.Background())
 }
 
-func (c *Controller) Download() (g []GamepadMap, err error) {
-	if _, err := c.port.Write([]byte(DownloadCmd)); err != nil {
-		return nil, fmt.Errorf("failed to write to port: %w", err)
+func (c *Controller) FirmwareInfoContext(ctx context.Context) (FirmwareInfo, error) {
+	v, err := c.submit(ctx, func(ctx context.Context) (interface{}, error) {
+		return c.firmwareInfo(ctx)
+	})
+	if err != nil {
+		return FirmwareInfo{}, err
 	}
 
-	m, err := readUntil(c.port, DownloadCompleteMsg)
+	return v.(FirmwareInfo), nil
+}
+
+// Require returns an UnsupportedError if the adapter firmware cannot perform
+// feature. The firmware info is queried if it has not been yet.
+func (c *Controller) Require(ctx context.Context, feature Feature) error {
+	_, err := c.submit(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, c.require(ctx, feature)
+	})
+
+	return err
+}
+
+func (c *Controller) Download() ([]GamepadMap, error) {
+	return c.DownloadContext(context.Background())
+}
+
+func (c *Controller) DownloadContext(ctx context.Context) ([]GamepadMap, error) {
+	v, err := c.submit(ctx, func(ctx context.Context) (interface{}, error) {
+		return c.download(ctx)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from port: %w", err)
+		return nil, err
 	}
 
-	lines := m[strings.Index(m, DownloadStartMsg)+len(DownloadStartMsg)+1 : strings.LastIndex(m, DownloadCompleteMsg)]
-	for _, line := range strings.Split(lines[1:len(lines)-2], "\r\n") {
-		var gamepadMap GamepadMap
+	return v.([]GamepadMap), nil
+}
 
-		for i, button := range strings.Split(line, " ") {
-			functions, err := strconv.ParseUint(button, 16, 8)
+func (c *Controller) Upload(n uint8, g GamepadMap) error {
+	return c.UploadContext(context.Background(), n, g)
+}
+
+func (c *Controller) UploadContext(ctx context.Context, n uint8, g GamepadMap) error {
+	_, err := c.submit(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, c.upload(ctx, n, g)
+	})
+
+	return err
+}
+
+func (c *Controller) firmwareVersion(ctx context.Context) (string, error) {
+	var version string
+
+	err := c.do(ctx, true, func(conn *conn) error {
+		ctx, cancel := withTimeout(ctx, c.Timeouts().Version)
+		defer cancel()
+
+		if c.framed {
+			resp, err := conn.exchange(ctx, "get firmware version", Frame{Cmd: FirmwareVersionCmd[0]})
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse button: %w", err)
+				return err
 			}
 
-			f := uint8(functions)
-			gamepadMap[i] = f
+			version = strings.TrimSpace(string(resp.Payload))
+
+			return nil
 		}
 
-		g = append(g, gamepadMap)
-	}
+		conn.discard()
+
+		if err := conn.write(ctx, "get firmware version", []byte(FirmwareVersionCmd)); err != nil {
+			return err
+		}
+
+		m, err := conn.readUntil(ctx, "get firmware version", FirmwareVersionCompleteMsg)
+		if err != nil {
+			return err
+		}
+
+		version = strings.TrimSpace(m[:strings.LastIndex(m, FirmwareVersionCompleteMsg)])
+
+		return nil
+	})
 
-	return g, nil
+	return version, err
 }
 
-func (c *Controller) Upload(n uint8, g GamepadMap) error {
-	if _, err := c.port.Write([]byte(UploadCmd)); err != nil {
-		return fmt.Errorf("failed to write to port: %w", err)
+func (c *Controller) firmwareInfo(ctx context.Context) (FirmwareInfo, error) {
+	raw, err := c.firmwareVersion(ctx)
+	if err != nil {
+		return FirmwareInfo{}, err
 	}
 
-	b := make([]byte, 1)
-	b[0] = n
-
-	if _, err := c.port.Write(b); err != nil {
-		return fmt.Errorf("failed to write to port: %w", err)
+	info, err := ParseFirmwareInfo(raw)
+	if err != nil {
+		return FirmwareInfo{}, err
 	}
+	c.info = &info
+	c.framed = c.opts.Protocol != ProtocolText && info.HasProtocol(ProtocolFramed)
 
-	for _, button := range g {
-		b := make([]byte, 1)
-		b[0] = button
+	return info, nil
+}
 
-		if _, err := c.port.Write(b); err != nil {
-			return fmt.Errorf("failed to write to port: %w", err)
+func (c *Controller) require(ctx context.Context, feature Feature) error {
+	if c.info == nil {
+		if _, err := c.firmwareInfo(ctx); err != nil {
+			return err
 		}
 	}
 
-	if _, err := readUntil(c.port, UploadDoneMsg); err != nil {
-		return fmt.Errorf("failed to read from port: %w", err)
+	return c.info.Require(feature)
+}
+
+func (c *Controller) download(ctx context.Context) ([]GamepadMap, error) {
+	if err := c.negotiate(ctx); err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	var g []GamepadMap
 
-func readUntil(port io.ReadWriteCloser, msg string) (string, error) {
-	var content strings.Builder
+	err := c.do(ctx, true, func(conn *conn) error {
+		ctx, cancel := withTimeout(ctx, c.Timeouts().Download)
+		defer cancel()
 
-	for {
-		buf := make([]byte, 128)
-		n, err := port.Read(buf)
-		if err != nil {
-			return "", fmt.Errorf("failed to read from port: %w", err)
+		if c.framed {
+			resp, err := conn.exchange(ctx, "download", Frame{Cmd: DownloadCmd[0]})
+			if err != nil {
+				return err
+			}
+
+			g, err = parseFramedMaps(resp.Payload, c.info.MapSlots)
+
+			return err
+		}
+
+		conn.discard()
+
+		if err := conn.write(ctx, "download", []byte(DownloadCmd)); err != nil {
+			return err
 		}
-		if n == 0 {
-			break
+
+		var p downloadParser
+		if c.info != nil {
+			p.mapCount = c.info.MapSlots
 		}
-		content.Write(buf[:n])
 
-		if strings.Contains(content.String(), msg) {
-			break
+		if err := conn.readFunc(ctx, "download", p.Write); err != nil {
+			return err
 		}
+
+		g = p.maps
+
+		return nil
+	})
+
+	return g, err
+}
+
+func (c *Controller) upload(ctx context.Context, n uint8, g GamepadMap) error {
+	if err := c.negotiate(ctx); err != nil {
+		return err
 	}
 
-	return content.String(), nil
+	if c.info != nil && int(n) >= c.info.MapSlots {
+		return fmt.Errorf("invalid map slot %d, the adapter has %d", n, c.info.MapSlots)
+	}
+
+	payload := append([]byte{n}, g[:]...)
+
+	// uploading the same map again has no further effect
+	return c.do(ctx, true, func(conn *conn) error {
+		ctx, cancel := withTimeout(ctx, c.Timeouts().Upload)
+		defer cancel()
+
+		if c.framed {
+			_, err := conn.exchange(ctx, "upload", Frame{Cmd: UploadCmd[0], Payload: payload})
+			return err
+		}
+
+		conn.discard()
+
+		if err := conn.write(ctx, "upload", append([]byte(UploadCmd), payload...)); err != nil {
+			return err
+		}
+
+		var reply strings.Builder
+		return conn.readFunc(ctx, "upload", func(b []byte) (bool, error) {
+			reply.Write(b)
+
+			// the slot is rejected with an error line instead of UploadDoneMsg
+			if i := strings.Index(reply.String(), ErrorMsg); i >= 0 {
+				reason, _, complete := strings.Cut(reply.String()[i+len(ErrorMsg):], "\n")
+				if !complete {
+					return false, nil
+				}
+				return true, fmt.Errorf("upload: %w: %s", ErrRejected, strings.TrimSpace(reason))
+			}
+
+			return strings.Contains(reply.String(), UploadDoneMsg), nil
+		})
+	})
 }
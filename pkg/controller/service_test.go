@@ -0,0 +1,51 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/emulator"
+)
+
+func TestUploadTextInvalidSlot(t *testing.T) {
+	e, err := emulator.New(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Register("upload-invalid-slot")
+	defer controller.UnregisterMemDevice("upload-invalid-slot")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the text protocol does not ask for the slot count, so the slot reaches
+	// the adapter
+	c, err := controller.OpenWithOptions(ctx, "mem://upload-invalid-slot", controller.ControllerOptions{
+		Protocol: controller.ProtocolText,
+	})
+	if err != nil {
+		t.Fatalf("failed to connect to the emulator: %v", err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	err = c.UploadContext(ctx, controller.MapCount, controller.GamepadMap{})
+	if !errors.Is(err, controller.ErrRejected) {
+		t.Fatalf("got %v, want ErrRejected", err)
+	}
+	if d := controller.DefaultTimeouts.Upload; time.Since(start) >= d {
+		t.Errorf("upload failed after %s, the timeout is %s", time.Since(start), d)
+	}
+
+	// the connection is still usable after the error
+	want := controller.GamepadMap{0x01, 0x02}
+	if err := c.UploadContext(ctx, 1, want); err != nil {
+		t.Fatalf("failed to upload after the error: %v", err)
+	}
+	if got := e.Maps()[1]; got != want {
+		t.Errorf("got map %v, want %v", got, want)
+	}
+}
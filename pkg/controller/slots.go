@@ -0,0 +1,42 @@
+package controller
+
+// SlotState classifies the map in a slot.
+type SlotState string
+
+const (
+	// SlotUnused maps no SNES button to an effective C64 function, see
+	// C64Function.Effective.
+	SlotUnused SlotState = "unused"
+	// SlotCustomized holds any other map.
+	SlotCustomized SlotState = "customized"
+)
+
+// Unused reports whether no button of g has an effect on the C64.
+func (g GamepadMap) Unused() bool {
+	for _, b := range g {
+		if C64Function(b).Effective() != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// State classifies g.
+func (g GamepadMap) State() SlotState {
+	if g.Unused() {
+		return SlotUnused
+	}
+
+	return SlotCustomized
+}
+
+// SlotStates classifies maps, the slots of an adapter.
+func SlotStates(maps []GamepadMap) []SlotState {
+	states := make([]SlotState, len(maps))
+	for i, m := range maps {
+		states[i] = m.State()
+	}
+
+	return states
+}
@@ -0,0 +1,25 @@
+package controller_test
+
+import (
+	"testing"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func TestSlotStates(t *testing.T) {
+	var autoFireOnly controller.GamepadMap
+	autoFireOnly.Set(controller.ButtonB, controller.AutoFire)
+
+	var mapped controller.GamepadMap
+	mapped.Set(controller.ButtonB, controller.Fire1, controller.AutoFire)
+
+	maps := []controller.GamepadMap{{}, autoFireOnly, mapped}
+	want := []controller.SlotState{controller.SlotUnused, controller.SlotUnused, controller.SlotCustomized}
+
+	got := controller.SlotStates(maps)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("map %s: got %s, want %s", maps[i].Hex(), got[i], want[i])
+		}
+	}
+}
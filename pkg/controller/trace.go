@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SchemeReplay = "replay"
+
+// Trace directions.
+const (
+	TraceOpen  = "open"
+	TraceTx    = "tx"
+	TraceRx    = "rx"
+	TraceError = "error"
+	TraceClose = "close"
+)
+
+var ErrReplayMismatch = errors.New("write differs from the trace")
+
+func init() {
+	RegisterOpener(SchemeReplay, openReplay)
+}
+
+// TraceEvent is a line of a trace file. Data holds the bytes in hex, Text
+// the same bytes quoted for reading the trace.
+type TraceEvent struct {
+	Time  time.Time `json:"time"`
+	Dir   string    `json:"dir"`
+	Data  string    `json:"data,omitempty"`
+	Text  string    `json:"text,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+func (e TraceEvent) Bytes() ([]byte, error) {
+	b, err := hex.DecodeString(e.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode trace data: %w", err)
+	}
+
+	return b, nil
+}
+
+// Tracer records the bytes sent and received over transports as JSON lines.
+// A Tracer can wrap several transports one after another, e.g. when a
+// Controller reconnects.
+type Tracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing the trace. Tracing stops after it.
+func (t *Tracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+// Wrap returns a transport that records everything passing through rwc.
+func (t *Tracer) Wrap(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+	t.record(nil, TraceOpen, nil, nil)
+
+	return &tracedTransport{rwc: rwc, tracer: t}
+}
+
+// record writes an event of tt, unless tt has been closed: reads still
+// running then only report the closed transport, and the trace may already
+// be in use by its owner.
+func (t *Tracer) record(tt *tracedTransport, dir string, p []byte, err error) {
+	e := TraceEvent{
+		Time: time.Now(),
+		Dir:  dir,
+	}
+	if len(p) > 0 {
+		e.Data = hex.EncodeToString(p)
+		e.Text = strings.Trim(strconv.Quote(string(p)), `"`)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tt != nil {
+		if tt.closed {
+			return
+		}
+		tt.closed = dir == TraceClose
+	}
+
+	if t.err == nil {
+		t.err = t.enc.Encode(e)
+	}
+}
+
+type tracedTransport struct {
+	rwc    io.ReadWriteCloser
+	tracer *Tracer
+
+	// closed is guarded by the mutex of tracer.
+	closed bool
+}
+
+func (t *tracedTransport) Read(p []byte) (int, error) {
+	n, err := t.rwc.Read(p)
+	if n > 0 {
+		t.tracer.record(t, TraceRx, p[:n], nil)
+	}
+	if err != nil {
+		t.tracer.record(t, TraceError, nil, err)
+	}
+
+	return n, err
+}
+
+// Write records p before writing it: the reply may arrive, and be recorded by
+// Read, before the write returns, and Replay relies on the recorded order.
+func (t *tracedTransport) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		t.tracer.record(t, TraceTx, p, nil)
+	}
+
+	n, err := t.rwc.Write(p)
+	if err != nil {
+		t.tracer.record(t, TraceError, nil, err)
+	}
+
+	return n, err
+}
+
+func (t *tracedTransport) Close() error {
+	t.tracer.record(t, TraceClose, nil, nil)
+
+	return t.rwc.Close()
+}
+
+// ReadTrace reads the events of a trace file.
+func ReadTrace(r io.Reader) ([]TraceEvent, error) {
+	var events []TraceEvent
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var e TraceEvent
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse trace line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+
+	return events, nil
+}
+
+// Replay is a transport playing back the first session of a trace. It
+// delivers the received bytes in the recorded order, holding back those
+// recorded after a write until the same bytes have been written, so a
+// Controller sees exactly what the adapter sent. Timing is not reproduced.
+type Replay struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	chunks []replayChunk
+	closed bool
+}
+
+type replayChunk struct {
+	dir  string
+	data []byte
+}
+
+func NewReplay(events []TraceEvent) (*Replay, error) {
+	r := &Replay{}
+	r.cond = sync.NewCond(&r.mu)
+
+	opened := false
+	for _, e := range events {
+		switch e.Dir {
+		case TraceOpen:
+			if opened {
+				return r, nil
+			}
+			opened = true
+		case TraceTx, TraceRx:
+			data, err := e.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			r.chunks = append(r.chunks, replayChunk{dir: e.Dir, data: data})
+		case TraceError:
+			r.chunks = append(r.chunks, replayChunk{dir: e.Dir})
+		case TraceClose:
+			return r, nil
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Replay) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for {
+		if r.closed {
+			return 0, io.ErrClosedPipe
+		}
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+
+		c := &r.chunks[0]
+		switch c.dir {
+		case TraceRx:
+			n := copy(p, c.data)
+			if c.data = c.data[n:]; len(c.data) == 0 {
+				r.chunks = r.chunks[1:]
+			}
+			r.cond.Broadcast()
+
+			return n, nil
+		case TraceError:
+			// the recorded session ended with a broken link
+			r.chunks = nil
+			r.cond.Broadcast()
+
+			return 0, io.EOF
+		}
+
+		r.cond.Wait()
+	}
+}
+
+func (r *Replay) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	written := 0
+	for written < len(p) {
+		if r.closed {
+			return written, io.ErrClosedPipe
+		}
+		if len(r.chunks) == 0 {
+			return written, fmt.Errorf("%w: %q written after the end", ErrReplayMismatch, p[written:])
+		}
+
+		c := &r.chunks[0]
+		if c.dir != TraceTx {
+			// the adapter sent more before the write was recorded
+			r.cond.Wait()
+			continue
+		}
+
+		n := len(c.data)
+		if rest := len(p) - written; rest < n {
+			n = rest
+		}
+		if string(p[written:written+n]) != string(c.data[:n]) {
+			return written, fmt.Errorf("%w: wrote %q instead of %q", ErrReplayMismatch, p[written:], c.data)
+		}
+
+		written += n
+		if c.data = c.data[n:]; len(c.data) == 0 {
+			r.chunks = r.chunks[1:]
+		}
+		r.cond.Broadcast()
+	}
+
+	return written, nil
+}
+
+func (r *Replay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	r.cond.Broadcast()
+
+	return nil
+}
+
+// openReplay replays the trace file at address, so "replay://session.jsonl"
+// can be used like any other target.
+func openReplay(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+	f, err := os.Open(address)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events, err := ReadTrace(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplay(events)
+}
@@ -0,0 +1,114 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/emulator"
+)
+
+// lateWriter returns from Write only after the reply has arrived, like a
+// serial driver can, so the reply is read before the write returns.
+type lateWriter struct {
+	io.ReadWriteCloser
+}
+
+func (w lateWriter) Write(p []byte) (int, error) {
+	n, err := w.ReadWriteCloser.Write(p)
+	time.Sleep(20 * time.Millisecond)
+
+	return n, err
+}
+
+func TestTraceReplayRoundTrip(t *testing.T) {
+	e, err := emulator.New(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.RegisterOpener("late", func(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+		return lateWriter{e.Pipe()}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	want := controller.GamepadMap{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x00, 0x00, 0x00}
+
+	// record a session against the emulator
+	var trace bytes.Buffer
+	c, err := controller.OpenWithOptions(ctx, "late://emulator", controller.ControllerOptions{Trace: &trace})
+	if err != nil {
+		t.Fatalf("failed to connect to the emulator: %v", err)
+	}
+	if _, err := c.FirmwareInfoContext(ctx); err != nil {
+		t.Fatalf("failed to get firmware info: %v", err)
+	}
+	if err := c.UploadContext(ctx, 3, want); err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	recorded, err := c.DownloadContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to download: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := controller.ReadTrace(&trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replay it with the same operations
+	replay, err := controller.NewReplay(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = controller.NewControllerFromTransportContext(ctx, replay)
+	if err != nil {
+		t.Fatalf("failed to connect to the replay: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.FirmwareInfoContext(ctx); err != nil {
+		t.Fatalf("failed to get firmware info from the replay: %v", err)
+	}
+	if err := c.UploadContext(ctx, 3, want); err != nil {
+		t.Fatalf("failed to upload to the replay: %v", err)
+	}
+	replayed, err := c.DownloadContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to download from the replay: %v", err)
+	}
+
+	if len(replayed) != len(recorded) {
+		t.Fatalf("replay returned %d maps, recorded %d", len(replayed), len(recorded))
+	}
+	for i := range recorded {
+		if replayed[i] != recorded[i] {
+			t.Errorf("map %d: replayed %s, recorded %s", i, replayed[i].Hex(), recorded[i].Hex())
+		}
+	}
+	if replayed[3] != want {
+		t.Errorf("map 3: got %s, want %s", replayed[3].Hex(), want.Hex())
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	replay, err := controller.NewReplay([]controller.TraceEvent{
+		{Dir: controller.TraceOpen},
+		{Dir: controller.TraceTx, Data: "76"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := replay.Write([]byte("d")); !errors.Is(err, controller.ErrReplayMismatch) {
+		t.Errorf("got %v, want %v", err, controller.ErrReplayMismatch)
+	}
+}
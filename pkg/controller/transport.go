@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	SchemeSerial = "serial"
+	SchemeTCP    = "tcp"
+	SchemePTY    = "pty"
+	SchemeMem    = "mem"
+)
+
+// Opener opens the transport behind address, which is the part of a target
+// after "scheme://".
+type Opener func(ctx context.Context, address string) (io.ReadWriteCloser, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = map[string]Opener{}
+
+	memDevicesMu sync.RWMutex
+	memDevices   = map[string]func(io.ReadWriteCloser){}
+)
+
+func init() {
+	RegisterOpener(SchemeSerial, openSerial)
+	RegisterOpener(SchemeTCP, openTCP)
+	RegisterOpener(SchemeMem, openMem)
+}
+
+// RegisterOpener makes targets of the form "scheme://address" available to
+// Open and OpenTransport. Registering a scheme twice replaces the opener.
+func RegisterOpener(scheme string, o Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	openers[scheme] = o
+}
+
+// Schemes returns the registered target schemes in alphabetical order.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// SplitTarget splits a target into its scheme and address. Targets without a
+// scheme, like "/dev/ttyUSB0" or "COM3", are serial ports.
+func SplitTarget(target string) (scheme, address string) {
+	if i := strings.Index(target, "://"); i >= 0 {
+		return target[:i], target[i+len("://"):]
+	}
+
+	return SchemeSerial, target
+}
+
+// OpenTransport opens the transport described by target without waiting for
+// the adapter to become ready. The target AutoTarget opens the port of the
+// best adapter found by DiscoverBest, which resets the adapter once more;
+// Open and OpenWithOptions keep the connection of the probe instead.
+func OpenTransport(target string) (io.ReadWriteCloser, error) {
+	return OpenTransportContext(context.Background(), target)
+}
+
+func OpenTransportContext(ctx context.Context, target string) (io.ReadWriteCloser, error) {
+	return openTransport(ctx, target, nil)
+}
+
+// openTransport opens serial ports, local or over RFC 2217, with settings, if
+// not nil, instead of the defaults of the registered opener.
+func openTransport(ctx context.Context, target string, settings *SerialSettings) (io.ReadWriteCloser, error) {
+	if target == AutoTarget {
+		port, err := DiscoverBest(ctx, DiscoverOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect adapter: %w", err)
+		}
+
+		target = port.Name
+	}
+
+	scheme, address := SplitTarget(target)
+
+	openersMu.RLock()
+	o, ok := openers[scheme]
+	openersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported transport scheme %q", scheme)
+	}
+	if scheme == SchemeSerial && settings != nil {
+		o = func(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+			return OpenSerial(ctx, address, *settings)
+		}
+	}
+	if scheme == SchemeRFC2217 && settings != nil {
+		o = func(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+			return DialRFC2217(ctx, address, *settings)
+		}
+	}
+
+	t, err := o(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", target, err)
+	}
+
+	return t, nil
+}
+
+// Open opens the transport described by target and returns a Controller once
+// the adapter reports that it is ready.
+func Open(target string) (*Controller, error) {
+	ctx, cancel := withTimeout(context.Background(), DefaultTimeouts.Connect)
+	defer cancel()
+
+	return OpenContext(ctx, target)
+}
+
+// OpenContext is Open bounded by ctx instead of DefaultTimeouts.Connect.
+func OpenContext(ctx context.Context, target string) (*Controller, error) {
+	return OpenWithOptions(ctx, target, ControllerOptions{})
+}
+
+// RegisterMemDevice makes an in-process device available as "mem://name".
+// Every Open of the target calls serve in a new goroutine with the device end
+// of an in-memory pipe.
+func RegisterMemDevice(name string, serve func(io.ReadWriteCloser)) {
+	memDevicesMu.Lock()
+	defer memDevicesMu.Unlock()
+
+	memDevices[name] = serve
+}
+
+// UnregisterMemDevice removes a device registered with RegisterMemDevice.
+func UnregisterMemDevice(name string) {
+	memDevicesMu.Lock()
+	defer memDevicesMu.Unlock()
+
+	delete(memDevices, name)
+}
+
+func openSerial(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+	return OpenSerial(ctx, address, SerialSettings{})
+}
+
+func openTCP(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", address)
+}
+
+func openMem(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+	memDevicesMu.RLock()
+	serve, ok := memDevices[address]
+	memDevicesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no in-memory device named %q", address)
+	}
+
+	host, device := net.Pipe()
+	go serve(device)
+
+	return host, nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package controller
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+)
+
+func init() {
+	RegisterOpener(SchemePTY, openPTY)
+}
+
+func openPTY(ctx context.Context, address string) (io.ReadWriteCloser, error) {
+	return os.OpenFile(address, os.O_RDWR|syscall.O_NOCTTY, 0)
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultUploadRetries is the number of additional uploads UploadVerified
+// attempts when the read back map differs.
+const DefaultUploadRetries = 2
+
+var ErrVerification = errors.New("verification failed")
+
+type ButtonDiff struct {
+	Button int
+	Want   uint8
+	Got    uint8
+}
+
+// VerificationError is returned when a map slot still differs from the
+// uploaded map after all attempts. It matches ErrVerification with
+// errors.Is.
+type VerificationError struct {
+	Slot     uint8
+	Attempts int
+	Diffs    []ButtonDiff
+}
+
+func (e *VerificationError) Error() string {
+	diffs := make([]string, len(e.Diffs))
+	for i, d := range e.Diffs {
+		diffs[i] = fmt.Sprintf("button %d is %02X instead of %02X", d.Button, d.Got, d.Want)
+	}
+
+	return fmt.Sprintf("map %d differs after %d attempts: %s", e.Slot, e.Attempts, strings.Join(diffs, ", "))
+}
+
+func (e *VerificationError) Is(target error) bool {
+	return target == ErrVerification
+}
+
+// DiffMaps lists the buttons whose functions differ between want and got.
+func DiffMaps(want, got GamepadMap) []ButtonDiff {
+	var diffs []ButtonDiff
+
+	for i := range want {
+		if want[i] != got[i] {
+			diffs = append(diffs, ButtonDiff{
+				Button: i,
+				Want:   want[i],
+				Got:    got[i],
+			})
+		}
+	}
+
+	return diffs
+}
+
+// UploadVerified uploads g to slot n, reads the slot back and uploads again up
+// to DefaultUploadRetries times while it differs.
+func (c *Controller) UploadVerified(n uint8, g GamepadMap) error {
+	return c.UploadVerifiedContext(context.Background(), n, g, DefaultUploadRetries)
+}
+
+func (c *Controller) UploadVerifiedContext(ctx context.Context, n uint8, g GamepadMap, retries int) error {
+	_, err := c.submit(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, c.uploadVerified(ctx, n, g, retries)
+	})
+
+	return err
+}
+
+func (c *Controller) uploadVerified(ctx context.Context, n uint8, g GamepadMap, retries int) error {
+	var diffs []ButtonDiff
+
+	attempts := 0
+	for attempts <= retries {
+		attempts++
+
+		if err := c.upload(ctx, n, g); err != nil {
+			return err
+		}
+
+		maps, err := c.download(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read back map %d: %w", n, err)
+		}
+		if int(n) >= len(maps) {
+			return fmt.Errorf("failed to read back map %d: the adapter returned %d maps", n, len(maps))
+		}
+
+		diffs = DiffMaps(g, maps[n])
+		if len(diffs) == 0 {
+			return nil
+		}
+	}
+
+	return &VerificationError{
+		Slot:     n,
+		Attempts: attempts,
+		Diffs:    diffs,
+	}
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type DeviceEventType int
+
+const (
+	Attached DeviceEventType = iota
+	Detached
+)
+
+func (t DeviceEventType) String() string {
+	switch t {
+	case Attached:
+		return "attached"
+	case Detached:
+		return "detached"
+	default:
+		return "unknown"
+	}
+}
+
+type DeviceEvent struct {
+	Type DeviceEventType
+	Port PortInfo
+}
+
+const DefaultWatchInterval = 500 * time.Millisecond
+
+type WatcherOptions struct {
+	// Interval between two port enumerations, DefaultWatchInterval if zero.
+	Interval time.Duration
+	// Filter selects the ports to report, PortInfo.LikelyAdapter if nil.
+	Filter func(PortInfo) bool
+}
+
+// Watcher polls the serial ports and reports adapters being plugged in and
+// out. Ports present when the Watcher starts are reported as attached.
+type Watcher struct {
+	opts   WatcherOptions
+	events chan DeviceEvent
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func NewWatcher(opts WatcherOptions) *Watcher {
+	if opts.Interval == 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if opts.Filter == nil {
+		opts.Filter = PortInfo.LikelyAdapter
+	}
+
+	w := &Watcher{
+		opts:   opts,
+		events: make(chan DeviceEvent, 16),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Events delivers the events until the Watcher is closed.
+func (w *Watcher) Events() <-chan DeviceEvent {
+	return w.events
+}
+
+func (w *Watcher) Close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer close(w.events)
+
+	known := map[string]PortInfo{}
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		// enumeration errors are transient, e.g. while a device is being
+		// registered, so the next poll simply tries again
+		if ports, err := ListPorts(); err == nil {
+			current := map[string]PortInfo{}
+			for _, p := range ports {
+				if w.opts.Filter(p) {
+					current[p.Name] = p
+				}
+			}
+
+			for name, p := range known {
+				if _, ok := current[name]; !ok && !w.emit(DeviceEvent{Type: Detached, Port: p}) {
+					return
+				}
+			}
+			for name, p := range current {
+				if _, ok := known[name]; !ok && !w.emit(DeviceEvent{Type: Attached, Port: p}) {
+					return
+				}
+			}
+
+			known = current
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *Watcher) emit(e DeviceEvent) bool {
+	select {
+	case w.events <- e:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
+// WaitForDevice blocks until a port selected by opts.Filter is present.
+func WaitForDevice(ctx context.Context, opts WatcherOptions) (PortInfo, error) {
+	w := NewWatcher(opts)
+	defer w.Close()
+
+	for {
+		select {
+		case e := <-w.Events():
+			if e.Type == Attached {
+				return e.Port, nil
+			}
+		case <-ctx.Done():
+			return PortInfo{}, ctxError(ctx, "wait for device")
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"snes2c64gui/pkg/controller"
+)
+
+// Status tells whether a slot is in both map sets or only in one.
+type Status string
+
+const (
+	Changed Status = "changed"
+	// Added slots are only in the second map set.
+	Added Status = "added"
+	// Removed slots are only in the first map set.
+	Removed Status = "removed"
+)
+
+// ButtonChange lists the functions a button gained and lost.
+type ButtonChange struct {
+	Button  controller.SNESButton
+	Added   controller.C64Function
+	Removed controller.C64Function
+}
+
+// SlotChange lists the changed buttons of a slot, in map order.
+type SlotChange struct {
+	Slot    int
+	Status  Status
+	Buttons []ButtonChange
+}
+
+// Maps compares the map sets a and b slot by slot. Slots with identical maps
+// are left out, so the result is empty if the sets are equal.
+func Maps(a, b []controller.GamepadMap) []SlotChange {
+	var changes []SlotChange
+
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var from, to controller.GamepadMap
+		status := Changed
+		switch {
+		case i >= len(b):
+			from = a[i]
+			status = Removed
+		case i >= len(a):
+			to = b[i]
+			status = Added
+		default:
+			from, to = a[i], b[i]
+		}
+
+		buttons := Map(from, to)
+		if len(buttons) == 0 && status == Changed {
+			continue
+		}
+
+		changes = append(changes, SlotChange{
+			Slot:    i,
+			Status:  status,
+			Buttons: buttons,
+		})
+	}
+
+	return changes
+}
+
+// Map compares two maps button by button.
+func Map(a, b controller.GamepadMap) []ButtonChange {
+	var changes []ButtonChange
+
+	for _, button := range controller.SNESButtons {
+		from, to := a.Get(button), b.Get(button)
+		if from == to {
+			continue
+		}
+
+		changes = append(changes, ButtonChange{
+			Button:  button,
+			Added:   to &^ from,
+			Removed: from &^ to,
+		})
+	}
+
+	return changes
+}
+
+// ansi colors of WriteColor
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+)
+
+// WriteText writes changes in a line per slot and button, e.g.
+//
+//	map 2:
+//	  B: +Fire2 -Fire1
+func WriteText(w io.Writer, changes []SlotChange) error {
+	return write(w, changes, false)
+}
+
+// WriteColor writes changes like WriteText with added functions in green and
+// removed ones in red, for terminals.
+func WriteColor(w io.Writer, changes []SlotChange) error {
+	return write(w, changes, true)
+}
+
+func write(w io.Writer, changes []SlotChange, color bool) error {
+	paint := func(code, s string) string {
+		return s
+	}
+	if color {
+		paint = func(code, s string) string {
+			return code + s + colorReset
+		}
+	}
+
+	for _, slot := range changes {
+		header := fmt.Sprintf("map %d:", slot.Slot)
+		switch slot.Status {
+		case Added:
+			header = fmt.Sprintf("map %d: only in b", slot.Slot)
+		case Removed:
+			header = fmt.Sprintf("map %d: only in a", slot.Slot)
+		}
+		if _, err := fmt.Fprintln(w, paint(colorBold, header)); err != nil {
+			return err
+		}
+
+		for _, b := range slot.Buttons {
+			line := fmt.Sprintf("  %s:", b.Button)
+			for _, f := range b.Added.Functions() {
+				line += " " + paint(colorGreen, "+"+f.String())
+			}
+			for _, f := range b.Removed.Functions() {
+				line += " " + paint(colorRed, "-"+f.String())
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type jsonSlot struct {
+	Slot    int          `json:"slot"`
+	Status  Status       `json:"status"`
+	Buttons []jsonButton `json:"buttons"`
+}
+
+type jsonButton struct {
+	Button  string   `json:"button"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// WriteJSON writes changes as a JSON array with the buttons and functions
+// by name.
+func WriteJSON(w io.Writer, changes []SlotChange) error {
+	slots := make([]jsonSlot, 0, len(changes))
+	for _, slot := range changes {
+		s := jsonSlot{
+			Slot:    slot.Slot,
+			Status:  slot.Status,
+			Buttons: make([]jsonButton, 0, len(slot.Buttons)),
+		}
+		for _, b := range slot.Buttons {
+			s.Buttons = append(s.Buttons, jsonButton{
+				Button:  b.Button.String(),
+				Added:   names(b.Added),
+				Removed: names(b.Removed),
+			})
+		}
+		slots = append(slots, s)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(slots)
+}
+
+func names(f controller.C64Function) []string {
+	names := []string{}
+	for _, fn := range f.Functions() {
+		names = append(names, fn.String())
+	}
+
+	return names
+}
@@ -0,0 +1,169 @@
+package diff_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/diff"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata")
+
+func joystick() controller.GamepadMap {
+	var g controller.GamepadMap
+	g.Set(controller.ButtonUp, controller.JoyUp)
+	g.Set(controller.ButtonDown, controller.JoyDown)
+	g.Set(controller.ButtonLeft, controller.JoyLeft)
+	g.Set(controller.ButtonRight, controller.JoyRight)
+	g.Set(controller.ButtonB, controller.Fire1)
+
+	return g
+}
+
+func TestMapsIdentical(t *testing.T) {
+	a := []controller.GamepadMap{joystick(), {}, joystick()}
+	b := []controller.GamepadMap{joystick(), {}, joystick()}
+
+	if changes := diff.Maps(a, b); len(changes) != 0 {
+		t.Errorf("got %+v for identical maps", changes)
+	}
+	if changes := diff.Map(joystick(), joystick()); len(changes) != 0 {
+		t.Errorf("got %+v for an identical map", changes)
+	}
+}
+
+func TestMaps(t *testing.T) {
+	changed := joystick()
+	changed.Set(controller.ButtonB, controller.Fire2)
+	changed.Add(controller.ButtonY, controller.Fire1|controller.AutoFire)
+
+	a := []controller.GamepadMap{joystick(), joystick(), joystick()}
+	b := []controller.GamepadMap{joystick(), changed}
+
+	want := []diff.SlotChange{
+		{
+			Slot:   1,
+			Status: diff.Changed,
+			Buttons: []diff.ButtonChange{
+				{Button: controller.ButtonB, Added: controller.Fire2, Removed: controller.Fire1},
+				{Button: controller.ButtonY, Added: controller.Fire1 | controller.AutoFire},
+			},
+		},
+		{
+			Slot:   2,
+			Status: diff.Removed,
+			Buttons: []diff.ButtonChange{
+				{Button: controller.ButtonUp, Removed: controller.JoyUp},
+				{Button: controller.ButtonDown, Removed: controller.JoyDown},
+				{Button: controller.ButtonLeft, Removed: controller.JoyLeft},
+				{Button: controller.ButtonRight, Removed: controller.JoyRight},
+				{Button: controller.ButtonB, Removed: controller.Fire1},
+			},
+		},
+	}
+	if got := diff.Maps(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// the other way round the slot is added
+	got := diff.Maps(b, a)
+	if len(got) != 2 || got[1].Slot != 2 || got[1].Status != diff.Added || len(got[1].Buttons) != 5 {
+		t.Errorf("got %+v, want slot 2 added", got)
+	}
+	if got[1].Buttons[0].Added != controller.JoyUp || got[1].Buttons[0].Removed != 0 {
+		t.Errorf("got %+v for the first button of the added slot", got[1].Buttons[0])
+	}
+}
+
+// TestMapsUnusedSlots checks that a slot only in one set is reported even if
+// its map is unused.
+func TestMapsUnusedSlots(t *testing.T) {
+	got := diff.Maps([]controller.GamepadMap{{}}, []controller.GamepadMap{{}, {}})
+	want := []diff.SlotChange{{Slot: 1, Status: diff.Added}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	changed := joystick()
+	changed.Set(controller.ButtonB, controller.Fire2)
+	changed.Add(controller.ButtonY, controller.Fire1|controller.AutoFire)
+
+	var added controller.GamepadMap
+	added.Set(controller.ButtonA, controller.Fire3)
+
+	// slot 1 changed, slot 3 added and slot 4 removed
+	changes := diff.Maps(
+		[]controller.GamepadMap{joystick(), joystick(), joystick()},
+		[]controller.GamepadMap{joystick(), changed, joystick(), added},
+	)
+	changes = append(changes, diff.Maps(
+		[]controller.GamepadMap{{}, {}, {}, {}, added},
+		[]controller.GamepadMap{{}, {}, {}, {}},
+	)...)
+
+	for _, tt := range []struct {
+		golden string
+		write  func(io.Writer, []diff.SlotChange) error
+	}{
+		{"diff.txt", diff.WriteText},
+		{"diff.color.txt", diff.WriteColor},
+		{"diff.json", diff.WriteJSON},
+	} {
+		t.Run(tt.golden, func(t *testing.T) {
+			var got bytes.Buffer
+			if err := tt.write(&got, changes); err != nil {
+				t.Fatal(err)
+			}
+
+			golden(t, tt.golden, got.Bytes())
+		})
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	var text, json bytes.Buffer
+	if err := diff.WriteText(&text, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff.WriteJSON(&json, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if text.Len() != 0 {
+		t.Errorf("got text %q without changes", text.String())
+	}
+	if json.String() != "[]\n" {
+		t.Errorf("got JSON %q without changes, want []", json.String())
+	}
+}
+
+// golden compares got with the file name in testdata, or writes it with
+// -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"snes2c64gui/pkg/flasher"
+)
+
+// DefaultBootloaderWindow is the time the bootloader waits for a programmer
+// after a reset, like optiboot.
+const DefaultBootloaderWindow = time.Second
+
+// Bootloader emulates optiboot, the STK500v1 bootloader of Arduino based
+// adapters.
+type Bootloader struct {
+	device flasher.Device
+
+	mu    sync.Mutex
+	flash []byte
+}
+
+// NewBootloader returns a bootloader with erased flash.
+func NewBootloader(device flasher.Device) *Bootloader {
+	return &Bootloader{
+		device: device,
+		flash:  bytes.Repeat([]byte{0xFF}, device.FlashSize),
+	}
+}
+
+// Flash returns a copy of the application flash.
+func (b *Bootloader) Flash() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]byte(nil), b.flash...)
+}
+
+// Serve speaks STK500v1 on rw until the programmer leaves programming mode.
+func (b *Bootloader) Serve(rw io.ReadWriter) error {
+	return b.serve(bufio.NewReader(rw), rw)
+}
+
+func (b *Bootloader) serve(r *bufio.Reader, w io.Writer) error {
+	var addr int
+
+	for {
+		cmd, err := r.ReadByte()
+		if err != nil {
+			return ignoreClosed(err)
+		}
+
+		var (
+			args  int
+			reply []byte
+			leave bool
+		)
+
+		switch cmd {
+		case flasher.STKGetParameter:
+			args = 1
+		case flasher.STKSetDevice:
+			args = 20
+		case flasher.STKSetDeviceExt:
+			args = 5
+		case flasher.STKLoadAddress:
+			args = 2
+		case flasher.STKUniversal:
+			args = 4
+		case flasher.STKProgPage, flasher.STKReadPage:
+			args = 3
+		}
+
+		arg := make([]byte, args)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return ignoreClosed(err)
+		}
+
+		switch cmd {
+		case flasher.STKGetParameter:
+			switch arg[0] {
+			case flasher.STKParamSWMajor:
+				reply = []byte{8}
+			case flasher.STKParamSWMinor:
+				reply = []byte{0}
+			default:
+				reply = []byte{0x03}
+			}
+		case flasher.STKLoadAddress:
+			addr = (int(arg[0]) | int(arg[1])<<8) * 2
+		case flasher.STKUniversal:
+			reply = []byte{0x00}
+		case flasher.STKProgPage:
+			page := make([]byte, int(arg[0])<<8|int(arg[1]))
+			if _, err := io.ReadFull(r, page); err != nil {
+				return ignoreClosed(err)
+			}
+			if arg[2] == flasher.STKMemoryFlash {
+				b.write(addr, page)
+			}
+		case flasher.STKReadPage:
+			reply = b.read(addr, int(arg[0])<<8|int(arg[1]))
+		case flasher.STKReadSignature:
+			reply = b.device.Signature[:]
+		case flasher.STKLeaveProgmode:
+			leave = true
+		}
+
+		eop, err := r.ReadByte()
+		if err != nil {
+			return ignoreClosed(err)
+		}
+		if eop != flasher.STKCRCEOP {
+			if _, err := w.Write([]byte{flasher.STKNoSync}); err != nil {
+				return ignoreClosed(err)
+			}
+			continue
+		}
+
+		resp := append([]byte{flasher.STKInSync}, reply...)
+		resp = append(resp, flasher.STKOk)
+		if _, err := w.Write(resp); err != nil {
+			return ignoreClosed(err)
+		}
+
+		if leave {
+			return nil
+		}
+	}
+}
+
+// write programs a page. Like the real bootloader, it protects itself by
+// ignoring writes beyond the application flash.
+func (b *Bootloader) write(addr int, page []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if addr < 0 || addr+len(page) > len(b.flash) {
+		return
+	}
+
+	copy(b.flash[addr:], page)
+}
+
+func (b *Bootloader) read(addr, n int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	page := bytes.Repeat([]byte{0xFF}, n)
+	if addr >= 0 && addr < len(b.flash) {
+		copy(page, b.flash[addr:])
+	}
+
+	return page
+}
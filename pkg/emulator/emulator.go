@@ -0,0 +1,415 @@
+package emulator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/flasher"
+)
+
+const (
+	DefaultVersion   = "1.1.0"
+	DefaultHardware  = "rev1"
+	DefaultBuildDate = "2023-01-15"
+)
+
+// detailedVersionSince is the first firmware that reports more than its
+// version, framedSince the first that speaks the framed protocol.
+var (
+	detailedVersionSince = controller.Version{Major: 1, Minor: 1}
+	framedSince          = controller.Version{Major: 1, Minor: 2}
+)
+
+// Options configure the emulated adapter.
+type Options struct {
+	// Version is the firmware version reported by the "v" command. It
+	// defaults to DefaultVersion. Firmware before 1.1.0 only reports its
+	// version, newer firmware also its build date, hardware and commands.
+	// Firmware since 1.2.0 also speaks the framed protocol.
+	Version string
+
+	// Hardware is the reported hardware revision, DefaultHardware if empty.
+	Hardware string
+
+	// BuildDate is the reported build date, DefaultBuildDate if empty.
+	BuildDate string
+
+	// EEPROMFile, if set, persists the map slots like the adapter EEPROM. The
+	// file is read on New and rewritten after every upload.
+	EEPROMFile string
+
+	// BootDelay is the time between a connection and the setup banner,
+	// imitating the Arduino boot after a reset.
+	BootDelay time.Duration
+
+	// NoReset imitates an adapter that is not reset by opening the port: it
+	// neither waits BootDelay nor prints the banner on a new connection.
+	NoReset bool
+
+	// Bootloader, if set, runs after every reset and waits BootloaderWindow,
+	// DefaultBootloaderWindow if zero, for a programmer before the firmware
+	// starts.
+	Bootloader       *Bootloader
+	BootloaderWindow time.Duration
+}
+
+// Emulator speaks the snes2c64 adapter protocol on any number of
+// connections, all sharing the same map slots.
+type Emulator struct {
+	opts    Options
+	version controller.Version
+
+	mu   sync.Mutex
+	maps [controller.MapCount]controller.GamepadMap
+}
+
+func New(opts Options) (*Emulator, error) {
+	if opts.Version == "" {
+		opts.Version = DefaultVersion
+	}
+	if opts.Hardware == "" {
+		opts.Hardware = DefaultHardware
+	}
+	if opts.BuildDate == "" {
+		opts.BuildDate = DefaultBuildDate
+	}
+
+	version, err := controller.ParseVersion(opts.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Emulator{
+		opts:    opts,
+		version: version,
+	}
+
+	if opts.EEPROMFile != "" {
+		if err := e.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Maps returns a copy of the map slots.
+func (e *Emulator) Maps() []controller.GamepadMap {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	maps := make([]controller.GamepadMap, controller.MapCount)
+	copy(maps, e.maps[:])
+
+	return maps
+}
+
+// SetMap writes a map slot as if it had been uploaded.
+func (e *Emulator) SetMap(n int, g controller.GamepadMap) error {
+	if n < 0 || n >= controller.MapCount {
+		return fmt.Errorf("invalid map slot %d", n)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.maps[n] = g
+
+	return e.save()
+}
+
+// Serve runs the firmware protocol on rw until it is closed. A closed
+// connection is not reported as an error.
+func (e *Emulator) Serve(rw io.ReadWriter) error {
+	r := bufio.NewReader(rw)
+
+	// peeked delivers the result of a read that outlasted the bootloader
+	// window, which has to end before r can be used
+	var peeked chan error
+
+	if !e.opts.NoReset && e.opts.Bootloader != nil {
+		window := e.opts.BootloaderWindow
+		if window == 0 {
+			window = DefaultBootloaderWindow
+		}
+
+		peeked = make(chan error, 1)
+		go func() {
+			_, err := r.Peek(1)
+			peeked <- err
+		}()
+
+		select {
+		case err := <-peeked:
+			peeked = nil
+			if err != nil {
+				return ignoreClosed(err)
+			}
+
+			if b, _ := r.Peek(1); b[0] == flasher.STKGetSync {
+				if err := e.opts.Bootloader.serve(r, rw); err != nil {
+					return err
+				}
+			}
+		case <-time.After(window):
+		}
+	}
+
+	if !e.opts.NoReset {
+		if e.opts.BootDelay > 0 {
+			time.Sleep(e.opts.BootDelay)
+		}
+
+		if err := e.write(rw, SetupBanner()); err != nil {
+			return err
+		}
+	}
+
+	if peeked != nil {
+		if err := <-peeked; err != nil {
+			return ignoreClosed(err)
+		}
+	}
+
+	for {
+		cmd, err := r.ReadByte()
+		if err != nil {
+			return ignoreClosed(err)
+		}
+
+		if cmd == controller.FrameStart && e.version.AtLeast(framedSince) {
+			if err := r.UnreadByte(); err != nil {
+				return err
+			}
+			if err := e.serveFrame(r, rw); err != nil {
+				return ignoreClosed(err)
+			}
+			continue
+		}
+
+		switch string(cmd) {
+		case controller.FirmwareVersionCmd:
+			err = e.write(rw, e.versionBlock())
+		case controller.DownloadCmd:
+			err = e.write(rw, e.downloadBlock())
+		case controller.UploadCmd:
+			err = e.upload(r, rw)
+		default:
+			// the firmware silently ignores unknown bytes, including line endings
+			continue
+		}
+
+		if err != nil {
+			return ignoreClosed(err)
+		}
+	}
+}
+
+// Pipe returns the host end of an in-memory connection served by e.
+func (e *Emulator) Pipe() io.ReadWriteCloser {
+	host, device := net.Pipe()
+
+	go func() {
+		defer device.Close()
+		_ = e.Serve(device)
+	}()
+
+	return host
+}
+
+// Register makes e available to controller.Open as "mem://name".
+func (e *Emulator) Register(name string) {
+	controller.RegisterMemDevice(name, func(device io.ReadWriteCloser) {
+		defer device.Close()
+		_ = e.Serve(device)
+	})
+}
+
+func SetupBanner() string {
+	return "snes2c64\r\n" + controller.SetupCompleteMsg + "\r\n"
+}
+
+func (e *Emulator) versionBlock() string {
+	return e.versionInfo() + controller.FirmwareVersionCompleteMsg + "\r\n"
+}
+
+// versionInfo is the reply to the version command without its terminator.
+func (e *Emulator) versionInfo() string {
+	var b strings.Builder
+
+	if !e.version.AtLeast(detailedVersionSince) {
+		fmt.Fprintf(&b, "snes2c64 v%s\r\n", e.version)
+
+		return b.String()
+	}
+
+	b.WriteString("snes2c64 firmware\r\n")
+	fmt.Fprintf(&b, "Version: %s\r\n", e.version)
+	fmt.Fprintf(&b, "Build: %s\r\n", e.opts.BuildDate)
+	fmt.Fprintf(&b, "Hardware: %s\r\n", e.opts.Hardware)
+	fmt.Fprintf(&b, "Slots: %d\r\n", controller.MapCount)
+	fmt.Fprintf(&b, "Buttons: %d\r\n", controller.ButtonCount)
+	fmt.Fprintf(&b, "Commands: %s\r\n", strings.Join(e.commands(), " "))
+	if e.version.AtLeast(framedSince) {
+		fmt.Fprintf(&b, "Protocols: %s %s\r\n", controller.ProtocolText, controller.ProtocolFramed)
+	}
+
+	return b.String()
+}
+
+// commands lists the commands the emulated firmware version understands.
+func (e *Emulator) commands() []string {
+	return []string{controller.FirmwareVersionCmd, controller.DownloadCmd, controller.UploadCmd}
+}
+
+func (e *Emulator) downloadBlock() string {
+	var b strings.Builder
+
+	b.WriteString(controller.DownloadStartMsg + "\r\n")
+	for _, m := range e.Maps() {
+		for i, button := range m {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "%X", button)
+		}
+		b.WriteString("\r\n")
+	}
+	b.WriteString(controller.DownloadCompleteMsg + "\r\n")
+
+	return b.String()
+}
+
+func (e *Emulator) upload(r io.Reader, w io.Writer) error {
+	buf := make([]byte, 1+controller.ButtonCount)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+
+	var g controller.GamepadMap
+	copy(g[:], buf[1:])
+
+	if err := e.SetMap(int(buf[0]), g); err != nil {
+		return e.write(w, fmt.Sprintf("%s %v\r\n", controller.ErrorMsg, err))
+	}
+
+	return e.write(w, controller.UploadDoneMsg+"\r\n")
+}
+
+// serveFrame answers the framed command read from r.
+func (e *Emulator) serveFrame(r io.ByteReader, w io.Writer) error {
+	req, err := controller.ReadFrame(r)
+	if errors.Is(err, controller.ErrChecksum) {
+		return e.writeFrame(w, errorFrame(err))
+	}
+	if err != nil {
+		return err
+	}
+
+	resp := controller.Frame{Cmd: req.Cmd}
+
+	switch string(req.Cmd) {
+	case controller.FirmwareVersionCmd:
+		resp.Payload = []byte(e.versionInfo())
+	case controller.DownloadCmd:
+		for _, m := range e.Maps() {
+			resp.Payload = append(resp.Payload, m[:]...)
+		}
+	case controller.UploadCmd:
+		if len(req.Payload) != 1+controller.ButtonCount {
+			resp = errorFrame(fmt.Errorf("upload of %d bytes, want %d", len(req.Payload), 1+controller.ButtonCount))
+			break
+		}
+
+		var g controller.GamepadMap
+		copy(g[:], req.Payload[1:])
+
+		if err := e.SetMap(int(req.Payload[0]), g); err != nil {
+			resp = errorFrame(err)
+		}
+	default:
+		resp = errorFrame(fmt.Errorf("unknown command %q", req.Cmd))
+	}
+
+	return e.writeFrame(w, resp)
+}
+
+func errorFrame(err error) controller.Frame {
+	return controller.Frame{Cmd: controller.FrameErrorCmd, Payload: []byte(err.Error())}
+}
+
+func (e *Emulator) writeFrame(w io.Writer, f controller.Frame) error {
+	b, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return e.write(w, string(b))
+}
+
+func (e *Emulator) write(w io.Writer, s string) error {
+	if _, err := io.WriteString(w, s); err != nil {
+		return fmt.Errorf("failed to write to host: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Emulator) load() error {
+	b, err := os.ReadFile(e.opts.EEPROMFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read eeprom file: %w", err)
+	}
+
+	if len(b) != controller.MapCount*controller.ButtonCount {
+		return fmt.Errorf("eeprom file %s has %d bytes, want %d", e.opts.EEPROMFile, len(b), controller.MapCount*controller.ButtonCount)
+	}
+
+	for i := range e.maps {
+		copy(e.maps[i][:], b[i*len(e.maps[i]):])
+	}
+
+	return nil
+}
+
+// save must be called with e.mu held.
+func (e *Emulator) save() error {
+	if e.opts.EEPROMFile == "" {
+		return nil
+	}
+
+	b := make([]byte, 0, controller.MapCount*controller.ButtonCount)
+	for _, m := range e.maps {
+		b = append(b, m[:]...)
+	}
+
+	tmp := e.opts.EEPROMFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write eeprom file: %w", err)
+	}
+
+	if err := os.Rename(tmp, e.opts.EEPROMFile); err != nil {
+		return fmt.Errorf("failed to write eeprom file: %w", err)
+	}
+
+	return nil
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
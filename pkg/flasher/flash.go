@@ -0,0 +1,194 @@
+package flasher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"snes2c64gui/pkg/controller"
+)
+
+// DefaultBaudRate is the baud rate of optiboot on the Arduino Uno and newer
+// Nanos. Nanos with the old bootloader use 57600.
+const DefaultBaudRate = 115200
+
+// DefaultSyncTimeout bounds the wait for the bootloader after the reset.
+const DefaultSyncTimeout = 3 * time.Second
+
+type Stage string
+
+const (
+	StageBackup  Stage = "backup"
+	StageSync    Stage = "sync"
+	StageWrite   Stage = "write"
+	StageVerify  Stage = "verify"
+	StageRestore Stage = "restore"
+)
+
+// Progress reports that Done of Total steps of Stage are complete.
+type Progress struct {
+	Stage Stage
+	Done  int
+	Total int
+}
+
+func report(progress func(Progress), stage Stage, done, total int) {
+	if progress != nil {
+		progress(Progress{Stage: stage, Done: done, Total: total})
+	}
+}
+
+type Options struct {
+	// Device is the microcontroller of the adapter, ATmega328P if zero.
+	Device Device
+	// BaudRate of the bootloader, DefaultBaudRate if zero.
+	BaudRate int
+	// SyncTimeout bounds the wait for the bootloader, DefaultSyncTimeout if
+	// zero.
+	SyncTimeout time.Duration
+
+	// SkipVerify skips reading the flash back after writing it.
+	SkipVerify bool
+	// SkipBackup skips saving the maps before and restoring them after
+	// flashing, e.g. because the old firmware does not answer anymore.
+	SkipBackup bool
+
+	// Controller configures the connections to the firmware before and after
+	// flashing.
+	Controller controller.ControllerOptions
+
+	OnProgress func(Progress)
+}
+
+// Update flashes img to the adapter at target. It saves the maps before and
+// restores them afterwards, in case the new firmware does not keep them, and
+// returns the info of the new firmware.
+func Update(ctx context.Context, target string, img *Image, opts Options) (controller.FirmwareInfo, error) {
+	if opts.Device.PageSize == 0 {
+		opts.Device = ATmega328P
+	}
+	if img.Size() > opts.Device.FlashSize {
+		return controller.FirmwareInfo{}, fmt.Errorf("%w: %d bytes, the %s has %d", ErrImageTooLarge, img.Size(), opts.Device.Name, opts.Device.FlashSize)
+	}
+
+	// all steps have to talk to the same adapter
+	if target == controller.AutoTarget {
+		port, err := controller.DiscoverBest(ctx, controller.DiscoverOptions{})
+		if err != nil {
+			return controller.FirmwareInfo{}, fmt.Errorf("failed to detect adapter: %w", err)
+		}
+		target = port.Name
+	}
+
+	var backup []controller.GamepadMap
+	if !opts.SkipBackup {
+		var err error
+		if backup, err = backupMaps(ctx, target, opts.Controller); err != nil {
+			return controller.FirmwareInfo{}, fmt.Errorf("failed to back up maps: %w", err)
+		}
+		report(opts.OnProgress, StageBackup, 1, 1)
+	}
+
+	if err := flash(ctx, target, img, opts); err != nil {
+		return controller.FirmwareInfo{}, err
+	}
+
+	c, err := connect(ctx, target, opts.Controller)
+	if err != nil {
+		return controller.FirmwareInfo{}, fmt.Errorf("failed to connect to the new firmware: %w", err)
+	}
+	defer c.Close()
+
+	info, err := c.FirmwareInfoContext(ctx)
+	if err != nil {
+		return controller.FirmwareInfo{}, fmt.Errorf("failed to get the new firmware version: %w", err)
+	}
+
+	if backup != nil {
+		if _, err := c.ApplyAllContext(ctx, backup); err != nil {
+			return info, fmt.Errorf("failed to restore maps: %w", err)
+		}
+		report(opts.OnProgress, StageRestore, 1, 1)
+	}
+
+	return info, nil
+}
+
+// connect opens target bounded by the connect timeout of opts.
+func connect(ctx context.Context, target string, opts controller.ControllerOptions) (*controller.Controller, error) {
+	timeout := controller.DefaultTimeouts.Connect
+	if opts.Timeouts != nil {
+		timeout = opts.Timeouts.Connect
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return controller.OpenWithOptions(ctx, target, opts)
+}
+
+func backupMaps(ctx context.Context, target string, opts controller.ControllerOptions) ([]controller.GamepadMap, error) {
+	c, err := connect(ctx, target, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return c.DownloadContext(ctx)
+}
+
+func flash(ctx context.Context, target string, img *Image, opts Options) error {
+	port, err := openBootloader(ctx, target, opts)
+	if err != nil {
+		return err
+	}
+	defer port.Close()
+
+	p := NewProgrammer(port)
+	defer p.Close()
+
+	timeout := opts.SyncTimeout
+	if timeout == 0 {
+		timeout = DefaultSyncTimeout
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, timeout)
+	err = p.Sync(syncCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	report(opts.OnProgress, StageSync, 1, 1)
+
+	return p.Flash(ctx, opts.Device, img, !opts.SkipVerify, opts.OnProgress)
+}
+
+// openBootloader opens target, which resets the adapter into the bootloader.
+// Serial ports are opened at the bootloader baud rate with DTR raised.
+func openBootloader(ctx context.Context, target string, opts Options) (io.ReadWriteCloser, error) {
+	scheme, address := controller.SplitTarget(target)
+	if scheme != controller.SchemeSerial {
+		return controller.OpenTransportContext(ctx, target)
+	}
+
+	settings := controller.SerialSettings{BaudRate: opts.BaudRate}
+	if opts.Controller.Serial != nil {
+		settings = *opts.Controller.Serial
+		settings.BaudRate = opts.BaudRate
+	}
+	if settings.BaudRate == 0 {
+		settings.BaudRate = DefaultBaudRate
+	}
+	settings.DTR = controller.LineOn
+
+	port, err := controller.OpenSerial(ctx, address, settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", target, err)
+	}
+
+	return port, nil
+}
@@ -0,0 +1,136 @@
+package flasher
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrInvalidHex = errors.New("invalid Intel HEX file")
+
+// Intel HEX record types.
+const (
+	recordData                   = 0x00
+	recordEOF                    = 0x01
+	recordExtendedSegmentAddress = 0x02
+	recordStartSegmentAddress    = 0x03
+	recordExtendedLinearAddress  = 0x04
+	recordStartLinearAddress     = 0x05
+)
+
+// maxImageSize bounds the images ParseHex accepts, far above the flash of
+// any adapter.
+const maxImageSize = 1 << 20
+
+// Image is a firmware image starting at flash address 0. Gaps between the
+// records of the HEX file are filled with 0xFF, the value of erased flash.
+type Image struct {
+	Data []byte
+}
+
+// Size returns the number of bytes to write.
+func (img *Image) Size() int {
+	return len(img.Data)
+}
+
+// ReadHexFile reads an Intel HEX file.
+func ReadHexFile(name string) (*Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open firmware: %w", err)
+	}
+	defer f.Close()
+
+	return ParseHex(f)
+}
+
+// ParseHex parses an Intel HEX image as produced by avr-objcopy and the
+// Arduino IDE.
+func ParseHex(r io.Reader) (*Image, error) {
+	img := &Image{}
+
+	var base uint32
+	eof := false
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		if eof {
+			return nil, fmt.Errorf("%w: line %d: data after the end of file record", ErrInvalidHex, line)
+		}
+		if !strings.HasPrefix(text, ":") {
+			return nil, fmt.Errorf("%w: line %d: missing start code", ErrInvalidHex, line)
+		}
+
+		b, err := hex.DecodeString(text[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidHex, line, err)
+		}
+		if len(b) < 5 || len(b) != int(b[0])+5 {
+			return nil, fmt.Errorf("%w: line %d: wrong record length", ErrInvalidHex, line)
+		}
+
+		var sum byte
+		for _, v := range b {
+			sum += v
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("%w: line %d: wrong checksum", ErrInvalidHex, line)
+		}
+
+		offset := uint32(b[1])<<8 | uint32(b[2])
+		data := b[4 : len(b)-1]
+
+		switch b[3] {
+		case recordData:
+			if uint64(base+offset)+uint64(len(data)) > maxImageSize {
+				return nil, fmt.Errorf("%w: line %d: address %X beyond %d bytes", ErrInvalidHex, line, base+offset, maxImageSize)
+			}
+			img.write(base+offset, data)
+		case recordEOF:
+			eof = true
+		case recordExtendedSegmentAddress:
+			if len(data) != 2 {
+				return nil, fmt.Errorf("%w: line %d: wrong segment address length", ErrInvalidHex, line)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 4
+		case recordExtendedLinearAddress:
+			if len(data) != 2 {
+				return nil, fmt.Errorf("%w: line %d: wrong linear address length", ErrInvalidHex, line)
+			}
+			base = (uint32(data[0])<<8 | uint32(data[1])) << 16
+		case recordStartSegmentAddress, recordStartLinearAddress:
+			// the bootloader always starts the application at 0
+		default:
+			return nil, fmt.Errorf("%w: line %d: unknown record type %02X", ErrInvalidHex, line, b[3])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read firmware: %w", err)
+	}
+
+	if !eof {
+		return nil, fmt.Errorf("%w: missing end of file record", ErrInvalidHex)
+	}
+	if len(img.Data) == 0 {
+		return nil, fmt.Errorf("%w: no data", ErrInvalidHex)
+	}
+
+	return img, nil
+}
+
+func (img *Image) write(addr uint32, data []byte) {
+	end := int(addr) + len(data)
+	for len(img.Data) < end {
+		img.Data = append(img.Data, 0xFF)
+	}
+
+	copy(img.Data[addr:], data)
+}
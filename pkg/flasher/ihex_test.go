@@ -0,0 +1,86 @@
+package flasher_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"snes2c64gui/pkg/flasher"
+)
+
+// record encodes an Intel HEX record with its checksum.
+func record(typ byte, addr uint16, data []byte) string {
+	b := []byte{byte(len(data)), byte(addr >> 8), byte(addr), typ}
+	b = append(b, data...)
+
+	var sum byte
+	for _, v := range b {
+		sum += v
+	}
+
+	return fmt.Sprintf(":%X\n", append(b, -sum))
+}
+
+const eofRecord = ":00000001FF\n"
+
+func TestParseHex(t *testing.T) {
+	img, err := flasher.ParseHex(strings.NewReader(
+		record(0x00, 0x0000, []byte{0x0C, 0x94}) +
+			record(0x00, 0x0004, []byte{0x01, 0x02}) +
+			eofRecord,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x0C, 0x94, 0xFF, 0xFF, 0x01, 0x02}
+	if !bytes.Equal(img.Data, want) {
+		t.Errorf("got % X, want % X", img.Data, want)
+	}
+}
+
+func TestParseHexExtendedAddress(t *testing.T) {
+	img, err := flasher.ParseHex(strings.NewReader(
+		record(0x04, 0x0000, []byte{0x00, 0x01}) +
+			record(0x00, 0x0002, []byte{0xAB}) +
+			eofRecord,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Size() != 0x10003 {
+		t.Fatalf("got %d bytes, want %d", img.Size(), 0x10003)
+	}
+	if img.Data[0x10002] != 0xAB || img.Data[0] != 0xFF {
+		t.Errorf("data at the extended address not placed at 0x10002")
+	}
+}
+
+func TestParseHexInvalid(t *testing.T) {
+	data := record(0x00, 0x0000, []byte{0x0C, 0x94})
+
+	tests := []struct {
+		name string
+		hex  string
+		want string
+	}{
+		{"bad checksum", ":020000000C9465\n" + eofRecord, "wrong checksum"},
+		{"missing EOF record", data, "missing end of file record"},
+		{"data after EOF record", data + eofRecord + data, "data after the end of file record"},
+		{"missing start code", strings.TrimPrefix(data, ":") + eofRecord, "missing start code"},
+		{"wrong record length", ":030000000C945D\n" + eofRecord, "wrong record length"},
+		{"no data", eofRecord, "no data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := flasher.ParseHex(strings.NewReader(tt.hex))
+			if !errors.Is(err, flasher.ErrInvalidHex) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %v: %s", err, flasher.ErrInvalidHex, tt.want)
+			}
+		})
+	}
+}
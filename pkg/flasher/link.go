@@ -0,0 +1,119 @@
+package flasher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// link reads the port in a background goroutine so that reads can time out
+// on any transport.
+type link struct {
+	port io.ReadWriter
+
+	rx      chan byte
+	done    chan struct{}
+	readErr error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newLink(port io.ReadWriter) *link {
+	l := &link{
+		port: port,
+		rx:   make(chan byte, 1024),
+		done: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+
+	go l.readLoop()
+
+	return l
+}
+
+func (l *link) readLoop() {
+	defer close(l.done)
+
+	buf := make([]byte, 256)
+	for {
+		n, err := l.port.Read(buf)
+		for _, b := range buf[:n] {
+			select {
+			case l.rx <- b:
+			case <-l.stop:
+				return
+			}
+		}
+		if n == 0 && err == nil {
+			err = io.EOF
+		}
+		if err != nil {
+			l.readErr = err
+			return
+		}
+	}
+}
+
+// close stops delivering received bytes. The port stays open.
+func (l *link) close() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+func (l *link) write(ctx context.Context, p []byte) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.port.Write(p)
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			return fmt.Errorf("failed to write to port: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to write to port: %w", ctx.Err())
+	}
+}
+
+// read returns the next n bytes.
+func (l *link) read(ctx context.Context, n int) ([]byte, error) {
+	b := make([]byte, 0, n)
+	for len(b) < n {
+		select {
+		case c := <-l.rx:
+			b = append(b, c)
+		case <-l.done:
+			select {
+			case c := <-l.rx:
+				b = append(b, c)
+			default:
+				return nil, fmt.Errorf("failed to read from port: %w", l.readErr)
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to read from port: %w", ctx.Err())
+		}
+	}
+
+	return b, nil
+}
+
+// discardFor drops everything received within d.
+func (l *link) discardFor(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-l.rx:
+		case <-timer.C:
+			return
+		}
+	}
+}
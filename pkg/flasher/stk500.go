@@ -0,0 +1,289 @@
+package flasher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// STK500v1 bytes, as far as optiboot implements the protocol.
+const (
+	STKOk      = 0x10
+	STKFailed  = 0x11
+	STKInSync  = 0x14
+	STKNoSync  = 0x15
+	STKCRCEOP  = 0x20
+	STKGetSync = 0x30
+
+	STKGetParameter  = 0x41
+	STKSetDevice     = 0x42
+	STKSetDeviceExt  = 0x45
+	STKEnterProgmode = 0x50
+	STKLeaveProgmode = 0x51
+	STKLoadAddress   = 0x55
+	STKUniversal     = 0x56
+	STKProgPage      = 0x64
+	STKReadPage      = 0x74
+	STKReadSignature = 0x75
+	STKParamSWMajor  = 0x81
+	STKParamSWMinor  = 0x82
+	STKMemoryFlash   = 'F'
+	STKMemoryEEPROM  = 'E'
+)
+
+var (
+	ErrNoSync            = errors.New("bootloader not in sync")
+	ErrWrongSignature    = errors.New("wrong device signature")
+	ErrImageTooLarge     = errors.New("firmware image too large")
+	ErrFlashVerification = errors.New("flash verification failed")
+)
+
+// Device describes the microcontroller of an adapter.
+type Device struct {
+	Name      string
+	Signature [3]byte
+	// PageSize is the size of a flash page in bytes.
+	PageSize int
+	// FlashSize is the flash available to the application, without the
+	// bootloader.
+	FlashSize int
+}
+
+// ATmega328P is the microcontroller of the Arduino Uno and Nano with the
+// 512 byte optiboot bootloader.
+var ATmega328P = Device{
+	Name:      "ATmega328P",
+	Signature: [3]byte{0x1E, 0x95, 0x0F},
+	PageSize:  128,
+	FlashSize: 32768 - 512,
+}
+
+// VerifyError is returned when the flash differs from the image after
+// writing. It matches ErrFlashVerification with errors.Is.
+type VerifyError struct {
+	Address int
+	Want    byte
+	Got     byte
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("flash at %04X is %02X instead of %02X", e.Address, e.Got, e.Want)
+}
+
+func (e *VerifyError) Is(target error) bool {
+	return target == ErrFlashVerification
+}
+
+// Programmer speaks STK500v1 to a bootloader.
+type Programmer struct {
+	link *link
+
+	// Timeout bounds every command.
+	Timeout time.Duration
+}
+
+// NewProgrammer uses port to talk to the bootloader. The Programmer reads
+// port in the background until the port fails or Close is called.
+func NewProgrammer(port io.ReadWriter) *Programmer {
+	return &Programmer{
+		link:    newLink(port),
+		Timeout: time.Second,
+	}
+}
+
+// Close releases the port, without closing it.
+func (p *Programmer) Close() {
+	p.link.close()
+}
+
+// Sync repeats the sync command until the bootloader answers. The
+// bootloader only listens for a short time after a reset, so ctx should end
+// shortly after that window.
+func (p *Programmer) Sync(ctx context.Context) error {
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		_, err := p.command(attemptCtx, []byte{STKGetSync}, 0)
+		cancel()
+		if err == nil {
+			// optiboot answers every sync sent while it was busy
+			p.link.discardFor(50 * time.Millisecond)
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ErrNoSync, err)
+		}
+	}
+}
+
+// Signature reads the device signature.
+func (p *Programmer) Signature(ctx context.Context) ([3]byte, error) {
+	var sig [3]byte
+
+	b, err := p.command(ctx, []byte{STKReadSignature}, 3)
+	if err != nil {
+		return sig, fmt.Errorf("failed to read signature: %w", err)
+	}
+	copy(sig[:], b)
+
+	return sig, nil
+}
+
+// Version reads the bootloader version.
+func (p *Programmer) Version(ctx context.Context) (major, minor byte, err error) {
+	b, err := p.command(ctx, []byte{STKGetParameter, STKParamSWMajor}, 1)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read bootloader version: %w", err)
+	}
+	major = b[0]
+
+	b, err = p.command(ctx, []byte{STKGetParameter, STKParamSWMinor}, 1)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read bootloader version: %w", err)
+	}
+
+	return major, b[0], nil
+}
+
+func (p *Programmer) EnterProgmode(ctx context.Context) error {
+	if _, err := p.command(ctx, []byte{STKEnterProgmode}, 0); err != nil {
+		return fmt.Errorf("failed to enter programming mode: %w", err)
+	}
+
+	return nil
+}
+
+// LeaveProgmode ends programming, which starts the application.
+func (p *Programmer) LeaveProgmode(ctx context.Context) error {
+	if _, err := p.command(ctx, []byte{STKLeaveProgmode}, 0); err != nil {
+		return fmt.Errorf("failed to leave programming mode: %w", err)
+	}
+
+	return nil
+}
+
+// WritePage writes a flash page at the byte address addr.
+func (p *Programmer) WritePage(ctx context.Context, addr int, page []byte) error {
+	if err := p.loadAddress(ctx, addr); err != nil {
+		return err
+	}
+
+	cmd := []byte{STKProgPage, byte(len(page) >> 8), byte(len(page)), STKMemoryFlash}
+	cmd = append(cmd, page...)
+
+	if _, err := p.command(ctx, cmd, 0); err != nil {
+		return fmt.Errorf("failed to write page %04X: %w", addr, err)
+	}
+
+	return nil
+}
+
+// ReadPage reads n bytes of flash at the byte address addr.
+func (p *Programmer) ReadPage(ctx context.Context, addr int, n int) ([]byte, error) {
+	if err := p.loadAddress(ctx, addr); err != nil {
+		return nil, err
+	}
+
+	b, err := p.command(ctx, []byte{STKReadPage, byte(n >> 8), byte(n), STKMemoryFlash}, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page %04X: %w", addr, err)
+	}
+
+	return b, nil
+}
+
+// loadAddress sets the address of the next page operation. Flash is
+// addressed in 16 bit words.
+func (p *Programmer) loadAddress(ctx context.Context, addr int) error {
+	word := addr / 2
+	if _, err := p.command(ctx, []byte{STKLoadAddress, byte(word), byte(word >> 8)}, 0); err != nil {
+		return fmt.Errorf("failed to load address %04X: %w", addr, err)
+	}
+
+	return nil
+}
+
+// command sends cmd followed by CRC_EOP and returns the n bytes of the
+// response between INSYNC and OK.
+func (p *Programmer) command(ctx context.Context, cmd []byte, n int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	if err := p.link.write(ctx, append(cmd, STKCRCEOP)); err != nil {
+		return nil, err
+	}
+
+	b, err := p.link.read(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != STKInSync {
+		return nil, fmt.Errorf("%w: got %02X instead of INSYNC", ErrNoSync, b[0])
+	}
+
+	b, err = p.link.read(ctx, n+1)
+	if err != nil {
+		return nil, err
+	}
+	if b[n] != STKOk {
+		return nil, fmt.Errorf("got %02X instead of OK", b[n])
+	}
+
+	return b[:n], nil
+}
+
+// Flash writes img page by page and, if verify is set, reads it back.
+// progress is called after every page, if not nil.
+func (p *Programmer) Flash(ctx context.Context, device Device, img *Image, verify bool, progress func(Progress)) error {
+	if img.Size() > device.FlashSize {
+		return fmt.Errorf("%w: %d bytes, the %s has %d", ErrImageTooLarge, img.Size(), device.Name, device.FlashSize)
+	}
+
+	sig, err := p.Signature(ctx)
+	if err != nil {
+		return err
+	}
+	if sig != device.Signature {
+		return fmt.Errorf("%w: % X instead of % X (%s)", ErrWrongSignature, sig[:], device.Signature[:], device.Name)
+	}
+
+	if err := p.EnterProgmode(ctx); err != nil {
+		return err
+	}
+
+	pages := (img.Size() + device.PageSize - 1) / device.PageSize
+	page := func(i int) []byte {
+		b := bytes.Repeat([]byte{0xFF}, device.PageSize)
+		copy(b, img.Data[i*device.PageSize:])
+		return b
+	}
+
+	for i := 0; i < pages; i++ {
+		if err := p.WritePage(ctx, i*device.PageSize, page(i)); err != nil {
+			return err
+		}
+		report(progress, StageWrite, i+1, pages)
+	}
+
+	if verify {
+		for i := 0; i < pages; i++ {
+			got, err := p.ReadPage(ctx, i*device.PageSize, device.PageSize)
+			if err != nil {
+				return err
+			}
+
+			want := page(i)
+			for j := range want {
+				if got[j] != want[j] {
+					return &VerifyError{Address: i*device.PageSize + j, Want: want[j], Got: got[j]}
+				}
+			}
+			report(progress, StageVerify, i+1, pages)
+		}
+	}
+
+	return p.LeaveProgmode(ctx)
+}
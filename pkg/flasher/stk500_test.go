@@ -0,0 +1,92 @@
+package flasher_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"snes2c64gui/pkg/emulator"
+	"snes2c64gui/pkg/flasher"
+)
+
+// serveBootloader connects a Programmer to b over an in-memory pipe.
+func serveBootloader(t *testing.T, b *emulator.Bootloader) *flasher.Programmer {
+	host, device := net.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Serve(device)
+		device.Close()
+	}()
+
+	p := flasher.NewProgrammer(host)
+	t.Cleanup(func() {
+		p.Close()
+		host.Close()
+		if err := <-done; err != nil {
+			t.Errorf("bootloader failed: %v", err)
+		}
+	})
+
+	return p
+}
+
+func TestFlash(t *testing.T) {
+	b := emulator.NewBootloader(flasher.ATmega328P)
+	p := serveBootloader(t, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// two and a half pages, so the last one is padded
+	img := &flasher.Image{Data: make([]byte, 2*flasher.ATmega328P.PageSize+64)}
+	for i := range img.Data {
+		img.Data[i] = byte(i * 7)
+	}
+
+	if err := p.Sync(ctx); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+
+	var last flasher.Progress
+	if err := p.Flash(ctx, flasher.ATmega328P, img, true, func(progress flasher.Progress) {
+		last = progress
+	}); err != nil {
+		t.Fatalf("failed to flash: %v", err)
+	}
+
+	if last.Stage != flasher.StageVerify || last.Done != last.Total || last.Total != 3 {
+		t.Errorf("last progress %+v, want 3 of 3 pages verified", last)
+	}
+
+	flash := b.Flash()
+	if !bytes.Equal(flash[:img.Size()], img.Data) {
+		t.Errorf("flash differs from the image")
+	}
+	if flash[img.Size()] != 0xFF {
+		t.Errorf("padding of the last page is %02X, want FF", flash[img.Size()])
+	}
+}
+
+func TestFlashWrongSignature(t *testing.T) {
+	other := flasher.ATmega328P
+	other.Signature = [3]byte{0x1E, 0x95, 0x14}
+
+	p := serveBootloader(t, emulator.NewBootloader(other))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.Sync(ctx); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+
+	img := &flasher.Image{Data: []byte{0x0C, 0x94}}
+	err := p.Flash(ctx, flasher.ATmega328P, img, true, nil)
+	if !errors.Is(err, flasher.ErrWrongSignature) {
+		t.Errorf("got %v, want %v", err, flasher.ErrWrongSignature)
+	}
+}
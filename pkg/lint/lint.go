@@ -0,0 +1,183 @@
+package lint
+
+import (
+	"fmt"
+
+	"snes2c64gui/pkg/controller"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("severity %d", int(s))
+	}
+}
+
+// The rules a Finding can violate.
+const (
+	// RuleOpposingDirections: a button presses up and down, or left and
+	// right, at once, which a real joystick cannot and games do not expect.
+	RuleOpposingDirections = "opposing-directions"
+	// RuleUnreachable: no button triggers a joystick direction or fire
+	// button 1, which almost every game needs.
+	RuleUnreachable = "unreachable"
+	// RuleIneffectiveAutoFire: a button has autofire but no fire button to
+	// repeat.
+	RuleIneffectiveAutoFire = "ineffective-autofire"
+	// RuleDirectionOffDPad: a D-pad button does not move the joystick in its
+	// direction.
+	RuleDirectionOffDPad = "direction-off-dpad"
+	// RuleDuplicateSlot: a map is identical to one in an earlier slot.
+	RuleDuplicateSlot = "duplicate-slot"
+)
+
+// Finding is a rule violation.
+type Finding struct {
+	Rule     string
+	Severity Severity
+	// Slot is the map slot, -1 for findings of Map.
+	Slot int
+	// Buttons are the SNES buttons involved, if any.
+	Buttons controller.SNESButton
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.Slot < 0 {
+		return fmt.Sprintf("%s: %s (%s)", f.Severity, f.Message, f.Rule)
+	}
+
+	return fmt.Sprintf("map %d: %s: %s (%s)", f.Slot, f.Severity, f.Message, f.Rule)
+}
+
+var (
+	opposing = []controller.C64Function{
+		controller.JoyUp | controller.JoyDown,
+		controller.JoyLeft | controller.JoyRight,
+	}
+	required = []controller.C64Function{
+		controller.JoyUp,
+		controller.JoyDown,
+		controller.JoyLeft,
+		controller.JoyRight,
+		controller.Fire1,
+	}
+	dpad = map[controller.SNESButton]controller.C64Function{
+		controller.ButtonUp:    controller.JoyUp,
+		controller.ButtonDown:  controller.JoyDown,
+		controller.ButtonLeft:  controller.JoyLeft,
+		controller.ButtonRight: controller.JoyRight,
+	}
+)
+
+// Map checks a single map. Unused maps have no findings.
+func Map(g controller.GamepadMap) []Finding {
+	return check(g, -1)
+}
+
+// Maps checks every slot of maps and compares the slots.
+func Maps(maps []controller.GamepadMap) []Finding {
+	var findings []Finding
+
+	for i, g := range maps {
+		findings = append(findings, check(g, i)...)
+
+		if g.Unused() {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if maps[j] == g {
+				findings = append(findings, Finding{
+					Rule:     RuleDuplicateSlot,
+					Severity: Warning,
+					Slot:     i,
+					Message:  fmt.Sprintf("identical to map %d", j),
+				})
+				break
+			}
+		}
+	}
+
+	return findings
+}
+
+func check(g controller.GamepadMap, slot int) []Finding {
+	if g.Unused() {
+		return nil
+	}
+
+	var findings []Finding
+	add := func(rule string, severity Severity, buttons controller.SNESButton, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Rule:     rule,
+			Severity: severity,
+			Slot:     slot,
+			Buttons:  buttons,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, b := range controller.SNESButtons {
+		f := g.Get(b)
+
+		for _, o := range opposing {
+			if f&o == o {
+				add(RuleOpposingDirections, Error, b, "%s presses %s at once", b, o)
+			}
+		}
+
+		if f&controller.AutoFire != 0 && f.Effective()&controller.AutoFire == 0 {
+			add(RuleIneffectiveAutoFire, Info, b, "%s has autofire but no fire button", b)
+		}
+
+		if want, ok := dpad[b]; ok && f&want == 0 {
+			add(RuleDirectionOffDPad, Warning, b, "%s does not press %s", b, want)
+		}
+	}
+
+	for _, f := range required {
+		if g.ButtonsFor(f) == 0 {
+			add(RuleUnreachable, Warning, 0, "no button presses %s", f)
+		}
+	}
+
+	return findings
+}
+
+// Max returns the highest severity of findings, or -1 if there are none.
+func Max(findings []Finding) Severity {
+	max := Severity(-1)
+	for _, f := range findings {
+		if f.Severity > max {
+			max = f.Severity
+		}
+	}
+
+	return max
+}
+
+// Slot returns the findings of slot.
+func Slot(findings []Finding, slot int) []Finding {
+	var filtered []Finding
+	for _, f := range findings {
+		if f.Slot == slot {
+			filtered = append(filtered, f)
+		}
+	}
+
+	return filtered
+}
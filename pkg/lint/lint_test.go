@@ -0,0 +1,166 @@
+package lint_test
+
+import (
+	"reflect"
+	"testing"
+
+	"snes2c64gui/pkg/controller"
+	"snes2c64gui/pkg/lint"
+)
+
+// clean maps the D-pad to the joystick and B to fire button 1.
+func clean() controller.GamepadMap {
+	var g controller.GamepadMap
+	g.Set(controller.ButtonUp, controller.JoyUp)
+	g.Set(controller.ButtonDown, controller.JoyDown)
+	g.Set(controller.ButtonLeft, controller.JoyLeft)
+	g.Set(controller.ButtonRight, controller.JoyRight)
+	g.Set(controller.ButtonB, controller.Fire1)
+
+	return g
+}
+
+// finding is a Finding without its message.
+type finding struct {
+	Rule     string
+	Severity lint.Severity
+	Slot     int
+	Buttons  controller.SNESButton
+}
+
+func strip(findings []lint.Finding) []finding {
+	var stripped []finding
+	for _, f := range findings {
+		stripped = append(stripped, finding{f.Rule, f.Severity, f.Slot, f.Buttons})
+	}
+
+	return stripped
+}
+
+func TestMap(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(g *controller.GamepadMap)
+		want   []finding
+	}{
+		{
+			name:   "clean",
+			change: func(g *controller.GamepadMap) {},
+		},
+		{
+			name: "unused",
+			change: func(g *controller.GamepadMap) {
+				*g = controller.GamepadMap{}
+				g.Set(controller.ButtonA, controller.AutoFire)
+			},
+		},
+		{
+			name: "opposing directions",
+			change: func(g *controller.GamepadMap) {
+				g.Set(controller.ButtonA, controller.JoyUp, controller.JoyDown)
+				g.Set(controller.ButtonL, controller.JoyLeft, controller.JoyRight)
+			},
+			want: []finding{
+				{lint.RuleOpposingDirections, lint.Error, -1, controller.ButtonA},
+				{lint.RuleOpposingDirections, lint.Error, -1, controller.ButtonL},
+			},
+		},
+		{
+			name: "unreachable",
+			change: func(g *controller.GamepadMap) {
+				g.Clear(controller.ButtonB)
+			},
+			want: []finding{
+				{lint.RuleUnreachable, lint.Warning, -1, 0},
+			},
+		},
+		{
+			name: "ineffective autofire",
+			change: func(g *controller.GamepadMap) {
+				g.Set(controller.ButtonY, controller.AutoFire)
+				g.Set(controller.ButtonX, controller.Fire2, controller.AutoFire)
+			},
+			want: []finding{
+				{lint.RuleIneffectiveAutoFire, lint.Info, -1, controller.ButtonY},
+			},
+		},
+		{
+			name: "direction off D-pad",
+			change: func(g *controller.GamepadMap) {
+				g.Set(controller.ButtonLeft, controller.JoyRight)
+				g.Set(controller.ButtonRight, controller.JoyLeft)
+			},
+			want: []finding{
+				{lint.RuleDirectionOffDPad, lint.Warning, -1, controller.ButtonLeft},
+				{lint.RuleDirectionOffDPad, lint.Warning, -1, controller.ButtonRight},
+			},
+		},
+		{
+			name: "direction off D-pad and unreachable",
+			change: func(g *controller.GamepadMap) {
+				g.Clear(controller.ButtonUp)
+			},
+			want: []finding{
+				{lint.RuleDirectionOffDPad, lint.Warning, -1, controller.ButtonUp},
+				{lint.RuleUnreachable, lint.Warning, -1, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := clean()
+			tt.change(&g)
+
+			if got := strip(lint.Map(g)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapsDuplicateSlot(t *testing.T) {
+	other := clean()
+	other.Set(controller.ButtonA, controller.Fire2)
+
+	maps := []controller.GamepadMap{clean(), other, {}, clean(), {}, other}
+
+	want := []finding{
+		{lint.RuleDuplicateSlot, lint.Warning, 3, 0},
+		{lint.RuleDuplicateSlot, lint.Warning, 5, 0},
+	}
+	findings := lint.Maps(maps)
+	if got := strip(findings); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if findings[0].Message != "identical to map 0" || findings[1].Message != "identical to map 1" {
+		t.Errorf("got messages %q and %q", findings[0].Message, findings[1].Message)
+	}
+
+	if got := lint.Slot(findings, 5); len(got) != 1 || got[0].Slot != 5 {
+		t.Errorf("got %+v for slot 5", got)
+	}
+}
+
+func TestMax(t *testing.T) {
+	if got := lint.Max(nil); got != -1 {
+		t.Errorf("got %v without findings, want -1", got)
+	}
+
+	findings := []lint.Finding{{Severity: lint.Info}, {Severity: lint.Error}, {Severity: lint.Warning}}
+	if got := lint.Max(findings); got != lint.Error {
+		t.Errorf("got %v, want %v", got, lint.Error)
+	}
+}
+
+func TestFindingString(t *testing.T) {
+	f := lint.Finding{Rule: lint.RuleUnreachable, Severity: lint.Warning, Slot: -1, Message: "no button presses Fire1"}
+	if got, want := f.String(), "warning: no button presses Fire1 (unreachable)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	f.Slot = 2
+	if got, want := f.String(), "map 2: warning: no button presses Fire1 (unreachable)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
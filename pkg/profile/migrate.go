@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Migration upgrades a decoded document of one schema version to the next,
+// in place. It does not need to change the schemaVersion field.
+type Migration func(doc map[string]interface{}) error
+
+var (
+	migrationsMu sync.Mutex
+	migrations   = map[int]Migration{}
+)
+
+// RegisterMigration sets the migration from schema version from to from+1.
+// Every version before SchemaVersion needs one for its documents to load.
+func RegisterMigration(from int, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	migrations[from] = m
+}
+
+// migrate upgrades doc to SchemaVersion.
+func migrate(doc map[string]interface{}) error {
+	return migrateTo(doc, SchemaVersion)
+}
+
+// migrateTo upgrades doc to the target schema version.
+func migrateTo(doc map[string]interface{}, target int) error {
+	version, err := schemaVersion(doc)
+	if err != nil {
+		return err
+	}
+	if version > target {
+		return fmt.Errorf("%w: schema version %d, this version reads up to %d", ErrNewerVersion, version, target)
+	}
+
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	for ; version < target; version++ {
+		m, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from schema version %d", version)
+		}
+		if err := m(doc); err != nil {
+			return fmt.Errorf("failed to migrate from schema version %d: %w", version, err)
+		}
+		doc["schemaVersion"] = version + 1
+	}
+
+	return nil
+}
+
+// schemaVersion returns the version of doc, which JSON decodes as float64 and
+// YAML as int.
+func schemaVersion(doc map[string]interface{}) (int, error) {
+	switch v := doc["schemaVersion"].(type) {
+	case nil:
+		return 0, errors.New("profile has no schemaVersion")
+	case int:
+		if v > 0 {
+			return v, nil
+		}
+	case float64:
+		if v > 0 && v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid schemaVersion %v", doc["schemaVersion"])
+}
@@ -0,0 +1,233 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"snes2c64gui/pkg/controller"
+)
+
+// SchemaVersion is the version of the profile documents this package writes.
+// Older documents are migrated when they are loaded.
+const SchemaVersion = 1
+
+var ErrNewerVersion = errors.New("profile was written by a newer version")
+
+// Profile is a set of all maps of an adapter with a description, as saved to
+// and loaded from a file.
+type Profile struct {
+	SchemaVersion int    `json:"schemaVersion" yaml:"schemaVersion"`
+	Name          string `json:"name" yaml:"name"`
+	Author        string `json:"author,omitempty" yaml:"author,omitempty"`
+	Notes         string `json:"notes,omitempty" yaml:"notes,omitempty"`
+	// Maps has one entry per map slot, MapCount in total.
+	Maps []Slot `json:"maps" yaml:"maps"`
+}
+
+// Slot is a map of a profile.
+type Slot struct {
+	Title       string                `json:"title,omitempty" yaml:"title,omitempty"`
+	Description string                `json:"description,omitempty" yaml:"description,omitempty"`
+	Map         controller.GamepadMap `json:"map" yaml:"map"`
+}
+
+// New returns a profile of maps without titles.
+func New(name string, maps []controller.GamepadMap) *Profile {
+	p := &Profile{
+		SchemaVersion: SchemaVersion,
+		Name:          name,
+	}
+	for _, g := range maps {
+		p.Maps = append(p.Maps, Slot{Map: g})
+	}
+
+	return p
+}
+
+// GamepadMaps returns the maps in slot order.
+func (p *Profile) GamepadMaps() []controller.GamepadMap {
+	maps := make([]controller.GamepadMap, 0, len(p.Maps))
+	for _, s := range p.Maps {
+		maps = append(maps, s.Map)
+	}
+
+	return maps
+}
+
+// Validate checks the fields the schema requires.
+func (p *Profile) Validate() error {
+	if p.SchemaVersion != SchemaVersion {
+		return fmt.Errorf("unsupported schema version %d", p.SchemaVersion)
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("profile has no name")
+	}
+	if len(p.Maps) != controller.MapCount {
+		return fmt.Errorf("profile has %d maps, want %d", len(p.Maps), controller.MapCount)
+	}
+
+	return nil
+}
+
+// Format is the encoding of a profile file.
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// ParseFormat parses "json" or "yaml".
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case JSON, YAML:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid profile format %q", s)
+	}
+}
+
+// FormatOf returns the format of a file by its extension, YAML for .yaml and
+// .yml and JSON otherwise.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML
+	default:
+		return JSON
+	}
+}
+
+// IsProfile reports whether path has the extension of a profile file.
+func IsProfile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// Decode reads a profile strictly: unknown fields, trailing documents and
+// missing maps are errors. Documents of older schema versions are migrated.
+func Decode(r io.Reader, format Format) (*Profile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	switch format {
+	case JSON:
+		err = decodeSingle(json.NewDecoder(bytes.NewReader(data)), &doc)
+	case YAML:
+		err = decodeSingle(yaml.NewDecoder(bytes.NewReader(data)), &doc)
+	default:
+		return nil, fmt.Errorf("invalid profile format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile: %w", err)
+	}
+	if doc == nil {
+		return nil, errors.New("profile is empty")
+	}
+
+	if err := migrate(doc); err != nil {
+		return nil, err
+	}
+
+	// the migrated document goes through JSON so that both formats are
+	// checked by the same strict decoder
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var p Profile
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+
+	return &p, nil
+}
+
+type decoder interface {
+	Decode(v interface{}) error
+}
+
+// decodeSingle decodes the only document of dec into v.
+func decodeSingle(dec decoder, v interface{}) error {
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	var rest interface{}
+	if err := dec.Decode(&rest); err != io.EOF {
+		return errors.New("unexpected data after the profile")
+	}
+
+	return nil
+}
+
+// Encode writes p in format with the current schema version.
+func Encode(w io.Writer, p *Profile, format Format) error {
+	p.SchemaVersion = SchemaVersion
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case YAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("invalid profile format %q", format)
+	}
+}
+
+// Load reads the profile file at path in the format of its extension.
+func Load(path string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profile: %w", err)
+	}
+	defer f.Close()
+
+	return Decode(f, FormatOf(path))
+}
+
+// Save writes p to path in the format of its extension.
+func Save(path string, p *Profile) error {
+	var b bytes.Buffer
+	if err := Encode(&b, p, FormatOf(path)); err != nil {
+		return fmt.Errorf("failed to encode profile: %w", err)
+	}
+
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+
+	return nil
+}
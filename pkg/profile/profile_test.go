@@ -0,0 +1,247 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"snes2c64gui/pkg/controller"
+)
+
+func testProfile() *Profile {
+	maps := make([]controller.GamepadMap, controller.MapCount)
+	for i := range maps {
+		maps[i] = controller.GamepadMap{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, byte(i), 0x00, 0xFF}
+	}
+
+	p := New("Test", maps)
+	p.Author = "Tester"
+	p.Notes = "Notes\nover two lines"
+	p.Maps[2].Title = "Jump on up"
+	p.Maps[2].Description = "Up on the d-pad jumps"
+
+	return p
+}
+
+// testDoc returns testProfile as a generic document, to be changed and
+// encoded by the tests.
+func testDoc(t *testing.T) map[string]interface{} {
+	var b bytes.Buffer
+	if err := Encode(&b, testProfile(), JSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func encodeDoc(t *testing.T, doc map[string]interface{}, format Format) []byte {
+	var (
+		b   []byte
+		err error
+	)
+	if format == YAML {
+		b, err = yaml.Marshal(doc)
+	} else {
+		b, err = json.Marshal(doc)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{JSON, YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			want := testProfile()
+
+			var b bytes.Buffer
+			if err := Encode(&b, want, format); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decode(&b, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownField(t *testing.T) {
+	for _, format := range []Format{JSON, YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			doc := testDoc(t)
+			doc["colour"] = "red"
+			if _, err := Decode(bytes.NewReader(encodeDoc(t, doc, format)), format); err == nil || !strings.Contains(err.Error(), "colour") {
+				t.Errorf("unknown profile field: got %v, want an error naming it", err)
+			}
+
+			doc = testDoc(t)
+			doc["maps"].([]interface{})[1].(map[string]interface{})["turbo"] = true
+			if _, err := Decode(bytes.NewReader(encodeDoc(t, doc, format)), format); err == nil || !strings.Contains(err.Error(), "turbo") {
+				t.Errorf("unknown slot field: got %v, want an error naming it", err)
+			}
+		})
+	}
+}
+
+func TestDecodeNewerVersion(t *testing.T) {
+	for _, format := range []Format{JSON, YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			doc := testDoc(t)
+			doc["schemaVersion"] = SchemaVersion + 1
+			doc["futureField"] = "ignored"
+
+			if _, err := Decode(bytes.NewReader(encodeDoc(t, doc, format)), format); !errors.Is(err, ErrNewerVersion) {
+				t.Errorf("got %v, want %v", err, ErrNewerVersion)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(doc map[string]interface{})
+	}{
+		{"no schema version", func(doc map[string]interface{}) { delete(doc, "schemaVersion") }},
+		{"schema version zero", func(doc map[string]interface{}) { doc["schemaVersion"] = 0 }},
+		{"fractional schema version", func(doc map[string]interface{}) { doc["schemaVersion"] = 1.5 }},
+		{"no name", func(doc map[string]interface{}) { doc["name"] = " " }},
+		{"missing map", func(doc map[string]interface{}) { doc["maps"] = doc["maps"].([]interface{})[1:] }},
+		{"invalid map", func(doc map[string]interface{}) {
+			doc["maps"].([]interface{})[0].(map[string]interface{})["map"] = "0102"
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, format := range []Format{JSON, YAML} {
+			t.Run(tt.name+"/"+string(format), func(t *testing.T) {
+				doc := testDoc(t)
+				tt.change(doc)
+
+				if _, err := Decode(bytes.NewReader(encodeDoc(t, doc, format)), format); err == nil {
+					t.Error("got no error")
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeTrailingDocument(t *testing.T) {
+	for _, format := range []Format{JSON, YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Encode(&b, testProfile(), format); err != nil {
+				t.Fatal(err)
+			}
+			data := b.String()
+			if format == YAML {
+				data += "---\n" + data
+			} else {
+				data += data
+			}
+
+			if _, err := Decode(strings.NewReader(data), format); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestMigration(t *testing.T) {
+	// a version 2 that renamed the notes of version 1 to description
+	RegisterMigration(1, func(doc map[string]interface{}) error {
+		if notes, ok := doc["notes"]; ok {
+			doc["description"] = notes
+			delete(doc, "notes")
+		}
+		return nil
+	})
+	t.Cleanup(func() {
+		migrationsMu.Lock()
+		delete(migrations, 1)
+		migrationsMu.Unlock()
+	})
+
+	for _, format := range []Format{JSON, YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			// JSON decodes the schema version as float64, YAML as int
+			unmarshal := json.Unmarshal
+			if format == YAML {
+				unmarshal = yaml.Unmarshal
+			}
+			var doc map[string]interface{}
+			if err := unmarshal(encodeDoc(t, testDoc(t), format), &doc); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := migrateTo(doc, 2); err != nil {
+				t.Fatal(err)
+			}
+
+			if doc["schemaVersion"] != 2 {
+				t.Errorf("got schema version %v, want 2", doc["schemaVersion"])
+			}
+			if _, ok := doc["notes"]; ok {
+				t.Error("notes were not migrated")
+			}
+			if doc["description"] != testProfile().Notes {
+				t.Errorf("got description %q, want %q", doc["description"], testProfile().Notes)
+			}
+		})
+	}
+
+	// version 1 is current, so its documents load without migrating
+	var b bytes.Buffer
+	if err := Encode(&b, testProfile(), JSON); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Decode(&b, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Notes != testProfile().Notes {
+		t.Errorf("got notes %q, want %q", p.Notes, testProfile().Notes)
+	}
+}
+
+func TestMigrationMissing(t *testing.T) {
+	doc := map[string]interface{}{"schemaVersion": 1}
+	if err := migrateTo(doc, 3); err == nil || !strings.Contains(err.Error(), "no migration from schema version 1") {
+		t.Errorf("got %v, want a missing migration", err)
+	}
+}
+
+func TestMigrationFailed(t *testing.T) {
+	fail := errors.New("cannot migrate")
+	RegisterMigration(1, func(doc map[string]interface{}) error { return fail })
+	t.Cleanup(func() {
+		migrationsMu.Lock()
+		delete(migrations, 1)
+		migrationsMu.Unlock()
+	})
+
+	doc := map[string]interface{}{"schemaVersion": 1.0}
+	if err := migrateTo(doc, 2); !errors.Is(err, fail) {
+		t.Errorf("got %v, want %v", err, fail)
+	}
+	if doc["schemaVersion"] != 1.0 {
+		t.Errorf("failed migration changed the schema version to %v", doc["schemaVersion"])
+	}
+}
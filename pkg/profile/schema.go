@@ -0,0 +1,9 @@
+package profile
+
+import _ "embed"
+
+// Schema is the JSON Schema of the current profile documents, for editors
+// and other tools. YAML profiles follow it as well.
+//
+//go:embed schema.json
+var Schema []byte